@@ -0,0 +1,170 @@
+// Package checkin keeps track of the devices that fetch the dashboard, from
+// the telemetry they send along with their requests.
+package checkin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	batteryGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gophercal_device_battery_volts",
+		Help: "Battery voltage the device reported on its last check-in.",
+	}, []string{"device"})
+	rssiGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gophercal_device_wifi_rssi_dbm",
+		Help: "Wi-Fi signal strength the device reported on its last check-in.",
+	}, []string{"device"})
+	lastCheckInGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gophercal_device_last_checkin_timestamp_seconds",
+		Help: "Unix time of the device's last check-in.",
+	}, []string{"device"})
+	infoGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gophercal_device_info",
+		Help: "Always 1, with the firmware version the device reported on its last check-in.",
+	}, []string{"device", "firmware"})
+)
+
+// The headers devices send their telemetry in. The same values can be passed
+// in the query parameters named after them, for devices that can't set headers.
+const (
+	HeaderID       = "X-Device-ID"
+	HeaderBattery  = "X-Battery-Voltage"
+	HeaderRSSI     = "X-Wifi-RSSI"
+	HeaderFirmware = "X-Firmware-Version"
+
+	ParamID       = "device_id"
+	ParamBattery  = "battery"
+	ParamRSSI     = "rssi"
+	ParamFirmware = "firmware"
+)
+
+// Report is what a device told us when it last checked in. HasBattery and
+// HasRSSI tell whether it sent its battery voltage and signal strength.
+type Report struct {
+	ID         string
+	Battery    float64 // volts
+	HasBattery bool
+	RSSI       int // dBm
+	HasRSSI    bool
+	Firmware   string
+	At         time.Time
+}
+
+// FromRequest reads the report a device sent along with r. It returns false
+// if the request didn't come with a device ID.
+func FromRequest(r *http.Request, now time.Time) (Report, bool, error) {
+	value := func(header, param string) string {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+		return r.URL.Query().Get(param)
+	}
+
+	report := Report{
+		ID:       value(HeaderID, ParamID),
+		Firmware: value(HeaderFirmware, ParamFirmware),
+		At:       now,
+	}
+	if report.ID == "" {
+		return Report{}, false, nil
+	}
+
+	if battery := value(HeaderBattery, ParamBattery); battery != "" {
+		v, err := strconv.ParseFloat(battery, 64)
+		if err != nil || v < 0 {
+			return Report{}, false, fmt.Errorf("invalid battery voltage %q from device %s", battery, report.ID)
+		}
+		report.Battery, report.HasBattery = v, true
+	}
+	if rssi := value(HeaderRSSI, ParamRSSI); rssi != "" {
+		v, err := strconv.Atoi(rssi)
+		if err != nil {
+			return Report{}, false, fmt.Errorf("invalid RSSI %q from device %s", rssi, report.ID)
+		}
+		report.RSSI, report.HasRSSI = v, true
+	}
+	return report, true, nil
+}
+
+// Store holds the last report of every device and exports them as metrics.
+type Store struct {
+	// lowBattery is the voltage below which a device's battery is low.
+	lowBattery float64
+	// maxDevices is the number of devices tracked. Anyone can send a device
+	// ID, so the reports and metric series they add are bounded.
+	maxDevices int
+
+	mtx     sync.Mutex
+	reports map[string]Report
+}
+
+// NewStore returns an empty store that tracks up to maxDevices devices.
+// Batteries below lowBattery volts are low.
+func NewStore(lowBattery float64, maxDevices int) *Store {
+	return &Store{
+		lowBattery: lowBattery,
+		maxDevices: maxDevices,
+		reports:    map[string]Report{},
+	}
+}
+
+// CheckIn records the report. Values missing from it are kept from the
+// device's previous report. It returns an error, and records nothing, for new
+// devices once maxDevices devices are tracked.
+func (s *Store) CheckIn(report Report) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	prev, ok := s.reports[report.ID]
+	if !ok && len(s.reports) >= s.maxDevices {
+		return fmt.Errorf("not tracking device %s, already tracking %d devices", report.ID, s.maxDevices)
+	}
+	if ok {
+		if !report.HasBattery {
+			report.Battery, report.HasBattery = prev.Battery, prev.HasBattery
+		}
+		if !report.HasRSSI {
+			report.RSSI, report.HasRSSI = prev.RSSI, prev.HasRSSI
+		}
+		if report.Firmware == "" {
+			report.Firmware = prev.Firmware
+		}
+		if report.Firmware != prev.Firmware {
+			infoGauge.DeleteLabelValues(report.ID, prev.Firmware)
+		}
+	}
+	s.reports[report.ID] = report
+
+	if report.HasBattery {
+		batteryGauge.WithLabelValues(report.ID).Set(report.Battery)
+	}
+	if report.HasRSSI {
+		rssiGauge.WithLabelValues(report.ID).Set(float64(report.RSSI))
+	}
+	lastCheckInGauge.WithLabelValues(report.ID).Set(float64(report.At.Unix()))
+	infoGauge.WithLabelValues(report.ID, report.Firmware).Set(1)
+	return nil
+}
+
+// Get returns the last report of the device with the given ID.
+func (s *Store) Get(id string) (Report, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	report, ok := s.reports[id]
+	return report, ok
+}
+
+// LowBattery returns whether the device with the given ID last reported a low battery.
+func (s *Store) LowBattery(id string) bool {
+	report, ok := s.Get(id)
+	return ok && report.HasBattery && report.Battery < s.lowBattery
+}
@@ -0,0 +1,144 @@
+package checkin
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFromRequest(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 10, 20, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		want    Report
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name: "no device ID",
+			url:  "/dash.jpg?battery=3.9",
+		},
+		{
+			name:    "headers",
+			url:     "/dash.jpg",
+			headers: map[string]string{HeaderID: "kitchen", HeaderBattery: "3.91", HeaderRSSI: "-67", HeaderFirmware: "1.2.0"},
+			want:    Report{ID: "kitchen", Battery: 3.91, HasBattery: true, RSSI: -67, HasRSSI: true, Firmware: "1.2.0", At: now},
+			wantOK:  true,
+		},
+		{
+			name:   "query parameters",
+			url:    "/dash.jpg?device_id=hall&battery=3.5&rssi=-80&firmware=abc",
+			want:   Report{ID: "hall", Battery: 3.5, HasBattery: true, RSSI: -80, HasRSSI: true, Firmware: "abc", At: now},
+			wantOK: true,
+		},
+		{
+			name:    "headers win over query parameters",
+			url:     "/dash.jpg?device_id=hall&rssi=-80",
+			headers: map[string]string{HeaderID: "kitchen"},
+			want:    Report{ID: "kitchen", RSSI: -80, HasRSSI: true, At: now},
+			wantOK:  true,
+		},
+		{
+			name:   "zero readings",
+			url:    "/dash.jpg?device_id=hall&battery=0&rssi=0",
+			want:   Report{ID: "hall", HasBattery: true, HasRSSI: true, At: now},
+			wantOK: true,
+		},
+		{
+			name:    "invalid battery",
+			url:     "/dash.jpg?device_id=hall&battery=full",
+			wantErr: true,
+		},
+		{
+			name:    "invalid rssi",
+			url:     "/dash.jpg?device_id=hall&rssi=-8.5",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tc.url, nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+
+			got, ok, err := FromRequest(r, now)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			if ok != tc.wantOK || got != tc.want {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestStoreKeepsMissingValues(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 10, 20, 0, 0, time.UTC)
+	store := NewStore(3.4, 10)
+
+	checkIn := func(report Report) {
+		t.Helper()
+		if err := store.CheckIn(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkIn(Report{ID: "kitchen", Battery: 3.3, HasBattery: true, RSSI: -70, HasRSSI: true, Firmware: "1.0", At: now})
+	if !store.LowBattery("kitchen") {
+		t.Error("3.3V should be a low battery")
+	}
+
+	checkIn(Report{ID: "kitchen", RSSI: 0, HasRSSI: true, At: now.Add(time.Minute)})
+	got, _ := store.Get("kitchen")
+	want := Report{ID: "kitchen", Battery: 3.3, HasBattery: true, RSSI: 0, HasRSSI: true, Firmware: "1.0", At: now.Add(time.Minute)}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	checkIn(Report{ID: "kitchen", Battery: 4.1, HasBattery: true, At: now.Add(2 * time.Minute)})
+	if store.LowBattery("kitchen") {
+		t.Error("4.1V shouldn't be a low battery")
+	}
+	if store.LowBattery("hall") {
+		t.Error("devices that never checked in shouldn't have a low battery")
+	}
+}
+
+func TestStoreFirmwareChange(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 10, 20, 0, 0, time.UTC)
+	store := NewStore(3.4, 10)
+
+	for _, firmware := range []string{"1.0", "1.1"} {
+		if err := store.CheckIn(Report{ID: "study", Firmware: firmware, At: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if infoGauge.DeleteLabelValues("study", "1.0") {
+		t.Error("the info series of the old firmware should be gone")
+	}
+	if !infoGauge.DeleteLabelValues("study", "1.1") {
+		t.Error("the info series of the new firmware should be exported")
+	}
+}
+
+func TestStoreMaxDevices(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 10, 20, 0, 0, time.UTC)
+	store := NewStore(3.4, 2)
+
+	for _, id := range []string{"a", "b", "a"} {
+		if err := store.CheckIn(Report{ID: id, At: now}); err != nil {
+			t.Fatalf("checking in %s: %v", id, err)
+		}
+	}
+	if err := store.CheckIn(Report{ID: "c", At: now}); err == nil {
+		t.Error("a third device should be refused")
+	}
+	if _, ok := store.Get("c"); ok {
+		t.Error("the refused device shouldn't be tracked")
+	}
+}
@@ -0,0 +1,113 @@
+// Package dasherr defines the kinds of errors that can stop the dashboard from
+// being rendered, so they can be reported to the user in a helpful way.
+package dasherr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Kind int
+
+const (
+	Unknown Kind = iota
+	// AuthExpired means the credentials for a service are missing, expired or revoked.
+	AuthExpired
+	// Unavailable means a service couldn't be reached or had an internal error.
+	Unavailable
+	// RateLimited means a service asked us to slow down.
+	RateLimited
+	// InvalidConfig means gophercal is configured in a way that can't work.
+	InvalidConfig
+	// NotFound means a service doesn't have the thing that was asked for,
+	// like a task that was deleted.
+	NotFound
+)
+
+func (k Kind) String() string {
+	switch k {
+	case AuthExpired:
+		return "auth expired"
+	case Unavailable:
+		return "upstream unavailable"
+	case RateLimited:
+		return "rate limited"
+	case InvalidConfig:
+		return "invalid config"
+	case NotFound:
+		return "not found"
+	}
+	return "unknown"
+}
+
+// Error is an error of a given kind that happened while talking to a service.
+type Error struct {
+	Kind    Kind
+	Service string
+	// RetryAfter is how long the service asked us to wait, if it did.
+	RetryAfter time.Duration
+
+	Err error
+}
+
+func New(kind Kind, service string, err error) *Error {
+	return &Error{Kind: kind, Service: service, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Service == "" {
+		return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Service, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// FromStatus wraps err, which a service responded to with the HTTP status code,
+// in an Error of the kind the code means. Errors whose code doesn't say what
+// went wrong are returned as they are.
+func FromStatus(service string, code int, err error) error {
+	switch {
+	case code == http.StatusBadRequest:
+		// The services reject requests built from settings they don't accept,
+		// like filters or coordinates, with a 400.
+		return New(InvalidConfig, service, err)
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return New(AuthExpired, service, err)
+	case code == http.StatusNotFound:
+		return New(NotFound, service, err)
+	case code == http.StatusTooManyRequests:
+		return New(RateLimited, service, err)
+	case code >= http.StatusInternalServerError:
+		return New(Unavailable, service, err)
+	}
+	return err
+}
+
+// KindOf returns the kind of the first Error in err's chain, or Unknown.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Unknown
+}
+
+// HTTPStatus returns the status code to respond with when err stops a request.
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case AuthExpired:
+		return http.StatusUnauthorized
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	case RateLimited:
+		return http.StatusTooManyRequests
+	case NotFound:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
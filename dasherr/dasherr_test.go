@@ -0,0 +1,59 @@
+package dasherr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	cause := errors.New("boom")
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: cause, want: http.StatusInternalServerError},
+		{err: New(AuthExpired, "todoist", cause), want: http.StatusUnauthorized},
+		{err: New(Unavailable, "google calendar", cause), want: http.StatusServiceUnavailable},
+		{err: New(RateLimited, "todoist", cause), want: http.StatusTooManyRequests},
+		{err: New(InvalidConfig, "", cause), want: http.StatusInternalServerError},
+		{err: New(NotFound, "todoist", cause), want: http.StatusNotFound},
+		{err: fmt.Errorf("error getting todoist tasks: %w", New(RateLimited, "todoist", cause)), want: http.StatusTooManyRequests},
+	}
+
+	for _, tc := range tests {
+		if got := HTTPStatus(tc.err); got != tc.want {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	cause := errors.New("boom")
+
+	tests := []struct {
+		code int
+		want Kind
+	}{
+		{code: http.StatusBadRequest, want: InvalidConfig},
+		{code: http.StatusUnauthorized, want: AuthExpired},
+		{code: http.StatusForbidden, want: AuthExpired},
+		{code: http.StatusNotFound, want: NotFound},
+		{code: http.StatusTooManyRequests, want: RateLimited},
+		{code: http.StatusInternalServerError, want: Unavailable},
+		{code: http.StatusBadGateway, want: Unavailable},
+		{code: http.StatusConflict, want: Unknown},
+	}
+
+	for _, tc := range tests {
+		err := FromStatus("todoist", tc.code, cause)
+		if got := KindOf(err); got != tc.want {
+			t.Errorf("FromStatus(%d) has kind %v, want %v", tc.code, got, tc.want)
+		}
+		if !errors.Is(err, cause) {
+			t.Errorf("FromStatus(%d) = %v, want it to wrap the cause", tc.code, err)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package gcalendar
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,9 +15,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+
+	"github.com/gouthamve/gophercal/dasherr"
 )
 
+// ServiceName is how errors from Google Calendar are labelled.
+const ServiceName = "Google Calendar"
+
 const (
 	calendarName = "primary"
 	// timeZone     = "Europe/Berlin"
@@ -36,34 +44,69 @@ type Event struct {
 	Start time.Time
 	End   time.Time
 
-	Title string
+	Title       string
+	Location    string
+	Description string
+	Organizer   string
+	Attendees   []Attendee
+
+	// HasConference is set when the event has a video call attached.
+	HasConference bool
+	// ColorID is the event's colour in Google Calendar, "1" to "11". It's
+	// empty for events in the calendar's own colour.
+	ColorID string
+
+	// ResponseStatus is our own response to the invitation. Optional is set
+	// when we're an optional attendee, and Transparent when the event doesn't
+	// block time in the calendar.
+	ResponseStatus string
+	Optional       bool
+	Transparent    bool
+}
+
+// The responses to an invitation.
+const (
+	ResponseNeedsAction = "needsAction"
+	ResponseDeclined    = "declined"
+	ResponseTentative   = "tentative"
+	ResponseAccepted    = "accepted"
+)
+
+type Attendee struct {
+	Name     string
+	Email    string
+	Optional bool
+
+	// ResponseStatus is one of the Response constants.
+	ResponseStatus string
 }
 
 type Calendar struct {
 	srv *calendar.Service
 
 	email    string
-	location string
+	loc      *time.Location
+	hideFree bool
 }
 
-func NewCalendar(config *oauth2.Config, tokenFile, email, location string) (*Calendar, error) {
+// NewCalendar creates a calendar for the given email address, with event times
+// in loc. Events that are marked as free are left out when hideFree is set.
+func NewCalendar(config *oauth2.Config, tokenFile, email string, loc *time.Location, hideFree bool) (*Calendar, error) {
 	ctx := context.Background()
 
 	client, err := getClient(config, tokenFile)
 	if err != nil {
-		return nil, err
+		return nil, dasherr.New(dasherr.AuthExpired, ServiceName, err)
 	}
 
 	client.Transport = promhttp.InstrumentRoundTripperDuration(clientCallHistogram, client.Transport)
 
 	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-	return &Calendar{srv: srv, email: email, location: location}, err
+	return &Calendar{srv: srv, email: email, loc: loc, hideFree: hideFree}, err
 }
 
-func (c Calendar) Events() ([]Event, error) {
-	startTime := time.Now().Add(-6 * time.Hour)
-	endTime := startTime.Add(15 * time.Hour)
-
+// Events returns the events that overlap the time range between startTime and endTime.
+func (c Calendar) Events(startTime, endTime time.Time) ([]Event, error) {
 	calEvents, err := c.srv.Events.List(calendarName).
 		TimeMin(startTime.Format(time.RFC3339)).
 		TimeMax(endTime.Format(time.RFC3339)).
@@ -72,20 +115,25 @@ func (c Calendar) Events() ([]Event, error) {
 		OrderBy("startTime").
 		Do()
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	var events []Event
 	for _, item := range calEvents.Items {
-		// skip the ones I said no to.
-		skip := false
+		// Events without attendees are our own.
+		status, optional := ResponseAccepted, false
 		for _, attendee := range item.Attendees {
-			if attendee.Email == c.email && attendee.ResponseStatus == "declined" {
-				skip = true
+			if attendee.Self || attendee.Email == c.email {
+				status, optional = attendee.ResponseStatus, attendee.Optional
 				break
 			}
 		}
-		if skip {
+		// skip the ones I said no to.
+		if status == ResponseDeclined {
+			continue
+		}
+		transparent := item.Transparency == "transparent"
+		if transparent && c.hideFree {
 			continue
 		}
 		if item.EventType == "workingLocation" {
@@ -104,20 +152,85 @@ func (c Calendar) Events() ([]Event, error) {
 			return nil, err
 		}
 
-		loc := time.Local
-		if c.location != "" {
-			loc, err = time.LoadLocation(c.location)
-			if err != nil {
-				log.Fatal(err)
+		organizer := ""
+		if item.Organizer != nil {
+			organizer = item.Organizer.DisplayName
+			if organizer == "" {
+				organizer = item.Organizer.Email
 			}
 		}
 
-		events = append(events, Event{Start: startTime.In(loc), End: endTime.In(loc), Title: item.Summary})
+		attendees := make([]Attendee, 0, len(item.Attendees))
+		for _, attendee := range item.Attendees {
+			attendees = append(attendees, Attendee{
+				Name:           attendee.DisplayName,
+				Email:          attendee.Email,
+				Optional:       attendee.Optional,
+				ResponseStatus: attendee.ResponseStatus,
+			})
+		}
+
+		events = append(events, Event{
+			Start:         startTime.In(c.loc),
+			End:           endTime.In(c.loc),
+			Title:         item.Summary,
+			Location:      item.Location,
+			Description:   item.Description,
+			Organizer:     organizer,
+			Attendees:     attendees,
+			HasConference: item.HangoutLink != "" || item.ConferenceData != nil,
+			ColorID:       item.ColorId,
+
+			ResponseStatus: status,
+			Optional:       optional,
+			Transparent:    transparent,
+		})
 	}
 
 	return events, nil
 }
 
+// classifyError wraps errors from the Google API in the matching dasherr kind.
+func classifyError(err error) error {
+	var (
+		retrieveErr *oauth2.RetrieveError
+		apiErr      *googleapi.Error
+		urlErr      *url.Error
+	)
+	switch {
+	case errors.As(err, &retrieveErr):
+		// The refresh token was revoked or expired.
+		return dasherr.New(dasherr.AuthExpired, ServiceName, err)
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusForbidden && isRateLimitReason(apiErr):
+			e := dasherr.New(dasherr.RateLimited, ServiceName, err)
+			if seconds, err := strconv.Atoi(apiErr.Header.Get("Retry-After")); err == nil {
+				e.RetryAfter = time.Duration(seconds) * time.Second
+			}
+			return e
+		case apiErr.Code == http.StatusNotFound:
+			// Most likely the configured calendar doesn't exist.
+			return dasherr.New(dasherr.InvalidConfig, ServiceName, err)
+		}
+		return dasherr.FromStatus(ServiceName, apiErr.Code, err)
+	case errors.As(err, &urlErr):
+		return dasherr.New(dasherr.Unavailable, ServiceName, err)
+	}
+	return err
+}
+
+// isRateLimitReason returns whether a 403 from the API is about the rate limit
+// rather than missing permissions.
+func isRateLimitReason(apiErr *googleapi.Error) bool {
+	for _, item := range apiErr.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
 // Retrieve a token, saves the token, then returns the generated client.
 func getClient(config *oauth2.Config, tokenFile string) (*http.Client, error) {
 	// The file token.json stores the user's access and refresh tokens, and is
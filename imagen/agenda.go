@@ -0,0 +1,177 @@
+package imagen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fogleman/gg"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+)
+
+const (
+	agendaRowHeight    = 70.0
+	agendaHeaderHeight = 40.0
+)
+
+// drawAgenda lists the events that haven't ended yet in chronological order,
+// with a header for every day, below top.
+func drawAgenda(calCtx *gg.Context, fonts *Fonts, theme *Theme, events []gcalendar.Event, now time.Time, top float64) {
+	titleFace := fonts.Face(Regular, 20)
+	detailFace := fonts.Face(Regular, 16)
+	calWidth, calHeight := float64(calCtx.Width()), float64(calCtx.Height())
+
+	upcoming := make([]gcalendar.Event, 0, len(events))
+	for _, event := range events {
+		if event.End.After(now) {
+			upcoming = append(upcoming, event)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].Start.Before(upcoming[j].Start)
+	})
+
+	calCtx.SetColor(theme.Foreground)
+	calCtx.SetFontFace(titleFace)
+	if len(upcoming) == 0 {
+		drawText(calCtx, "No upcoming events", calWidth/2, (top+calHeight)/2, 0.5, 0.5)
+		return
+	}
+
+	rowWidth := calWidth - 2*theme.OutsideBoundaryWidth
+	textX := theme.OutsideBoundaryWidth + theme.InnerBoundaryWidth
+	textWidth := rowWidth - 2*theme.InnerBoundaryWidth
+
+	yStart := top
+	day := ""
+	for i, event := range upcoming {
+		header := event.Start.Format("Monday, Jan 2")
+		if event.Start.Before(now) {
+			header = now.Format("Monday, Jan 2")
+		}
+
+		needed := agendaRowHeight
+		if header != day {
+			needed += agendaHeaderHeight
+		}
+		// Leave room for the "+N more events" row unless this is the last event.
+		if i < len(upcoming)-1 {
+			needed += agendaHeaderHeight
+		}
+		if yStart+needed > calHeight {
+			calCtx.SetFontFace(fonts.Face(Italic, 20))
+			more := truncateString(calCtx, createMoreEventsText(len(upcoming)-i), textWidth)
+			drawText(calCtx, more, textX, yStart+agendaHeaderHeight/2, 0, 0.5)
+			return
+		}
+
+		if header != day {
+			calCtx.DrawRoundedRectangle(theme.OutsideBoundaryWidth, yStart, rowWidth, agendaHeaderHeight, theme.CornerRadius)
+			calCtx.SetColor(theme.HeaderFill)
+			calCtx.Fill()
+
+			calCtx.SetColor(theme.Foreground)
+			calCtx.SetFontFace(fonts.Face(Bold, 20))
+			drawText(calCtx, truncateString(calCtx, header, textWidth), textX, yStart+agendaHeaderHeight/2, 0, 0.5)
+
+			day = header
+			yStart += agendaHeaderHeight
+		}
+
+		calCtx.SetLineWidth(theme.LineWidth)
+		calCtx.DrawRoundedRectangle(theme.OutsideBoundaryWidth, yStart, rowWidth, agendaRowHeight, theme.CornerRadius)
+		calCtx.Stroke()
+
+		rowTextX, rowTextWidth := textX, textWidth
+		if ink, ok := eventInk(theme, event); ok {
+			drawColorStripe(calCtx, ink, theme.OutsideBoundaryWidth, theme.OutsideBoundaryWidth, yStart, rowWidth, agendaRowHeight, theme.CornerRadius)
+			calCtx.SetColor(theme.Foreground)
+			rowTextX += colorStripeWidth
+			rowTextWidth -= colorStripeWidth
+		}
+
+		details := createEventDetailsText(event)
+		titleY := yStart + agendaRowHeight/2
+		if details != "" {
+			titleY = yStart + agendaRowHeight/3
+
+			calCtx.SetFontFace(detailFace)
+			details = truncateString(calCtx, details, rowTextWidth)
+			drawText(calCtx, details, rowTextX, yStart+agendaRowHeight*2/3, 0, 0.5)
+		}
+
+		calCtx.SetFontFace(titleFace)
+		title := fmt.Sprintf("%s  %s", createTimeRangeText(event), event.Title)
+		drawText(calCtx, truncateString(calCtx, title, rowTextWidth), rowTextX, titleY, 0, 0.5)
+
+		yStart += agendaRowHeight
+	}
+}
+
+// maxConcurrentEvents returns the largest number of events that are happening at the same time.
+func maxConcurrentEvents(events []gcalendar.Event) int {
+	type edge struct {
+		at    time.Time
+		delta int
+	}
+
+	edges := make([]edge, 0, 2*len(events))
+	for _, event := range events {
+		edges = append(edges, edge{at: event.Start, delta: 1}, edge{at: event.End, delta: -1})
+	}
+	// Events ending at the same time another one starts don't overlap.
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at.Equal(edges[j].at) {
+			return edges[i].delta < edges[j].delta
+		}
+		return edges[i].at.Before(edges[j].at)
+	})
+
+	current, max := 0, 0
+	for _, e := range edges {
+		current += e.delta
+		if current > max {
+			max = current
+		}
+	}
+	return max
+}
+
+func createTimeRangeText(event gcalendar.Event) string {
+	return fmt.Sprintf("%s–%s", event.Start.Format("15:04"), event.End.Format("15:04"))
+}
+
+func createEventDetailsText(event gcalendar.Event) string {
+	details := []string{}
+	switch event.ResponseStatus {
+	case gcalendar.ResponseNeedsAction:
+		details = append(details, "Not responded")
+	case gcalendar.ResponseTentative:
+		details = append(details, "Tentative")
+	}
+	if event.Optional {
+		details = append(details, "Optional")
+	}
+	if event.Location != "" {
+		details = append(details, event.Location)
+	}
+	if event.HasConference {
+		details = append(details, "Video call")
+	}
+	switch {
+	case len(event.Attendees) == 1:
+		details = append(details, "1 attendee")
+	case len(event.Attendees) > 1:
+		details = append(details, fmt.Sprintf("%d attendees", len(event.Attendees)))
+	}
+	return strings.Join(details, " · ")
+}
+
+func createMoreEventsText(count int) string {
+	if count == 1 {
+		return "+1 more event"
+	}
+	return fmt.Sprintf("+%d more events", count)
+}
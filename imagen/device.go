@@ -0,0 +1,140 @@
+package imagen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// The formats images are served in. JPEG is smaller, but dithered images for
+// colour and 1-bit displays need to be lossless.
+const (
+	FormatJPEG = "jpg"
+	FormatPNG  = "png"
+)
+
+// Device is a display the dashboard is shown on.
+type Device struct {
+	Name string
+	// Width and Height are the size of the panel in pixels, as its framebuffer is laid out.
+	Width, Height int
+	// BitDepth is the number of bits per pixel the panel shows. Grey images
+	// are rounded to the shades that fit in it, see Quantize.
+	BitDepth int
+	// Palette holds the panel's inks. Images dithered to it are encoded with
+	// as many bits per pixel as it takes to tell the inks apart.
+	Palette *Palette
+	// Format is the image format the device reads, FormatJPEG or FormatPNG.
+	Format string
+	// Rotation is how far clockwise, in degrees, the dashboard is turned to
+	// fit on the panel. Panels with a portrait framebuffer that are mounted
+	// on their side, like Kindles, are turned by 90 so the dashboard is
+	// looked at in landscape.
+	Rotation int
+}
+
+// DefaultDevice is the name of the device used when none is configured.
+const DefaultDevice = "inkplate10"
+
+var devices = map[string]Device{
+	// The Inkplates show 8 greys, and their images are rounded to them
+	// rather than dithered, which JPEG would smear.
+	DefaultDevice:     {Width: 1200, Height: 825, BitDepth: 3, Palette: palettes[GrayscalePalette], Format: FormatJPEG},
+	"inkplate6":       {Width: 800, Height: 600, BitDepth: 3, Palette: palettes[GrayscalePalette], Format: FormatJPEG},
+	"inkplate6color":  {Width: 600, Height: 448, BitDepth: 3, Palette: palettes["7color"], Format: FormatPNG},
+	"inky-frame-4":    {Width: 640, Height: 400, BitDepth: 3, Palette: palettes["7color"], Format: FormatPNG},
+	"inky-frame-5.7":  {Width: 600, Height: 448, BitDepth: 3, Palette: palettes["7color"], Format: FormatPNG},
+	"inky-frame-7.3":  {Width: 800, Height: 480, BitDepth: 3, Palette: palettes["7color"], Format: FormatPNG},
+	"waveshare-7.5v2": {Width: 800, Height: 480, BitDepth: 1, Palette: palettes["bw"], Format: FormatPNG},
+	// Kindles have a portrait framebuffer, with 16 shades of grey.
+	"kindle":            {Width: 600, Height: 800, BitDepth: 4, Palette: palettes["gray16"], Format: FormatPNG, Rotation: 90},
+	"kindle-paperwhite": {Width: 1072, Height: 1448, BitDepth: 4, Palette: palettes["gray16"], Format: FormatPNG, Rotation: 90},
+	"trmnl":             {Width: 800, Height: 480, BitDepth: 1, Palette: palettes["bw"], Format: FormatPNG},
+}
+
+// DeviceNames returns the names of the built-in devices.
+func DeviceNames() []string {
+	names := make([]string, 0, len(devices))
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadDevice returns the built-in device called name.
+func LoadDevice(name string) (Device, error) {
+	device, ok := devices[name]
+	if !ok {
+		return Device{}, fmt.Errorf("unknown device %q, use one of %s", name, strings.Join(DeviceNames(), ", "))
+	}
+	device.Name = name
+	return device, nil
+}
+
+// Size returns the size the dashboard is drawn at for the device: the panel
+// size, turned by the device's rotation.
+func (d Device) Size() (width, height int) {
+	if d.Rotation == 90 || d.Rotation == 270 {
+		return d.Height, d.Width
+	}
+	return d.Width, d.Height
+}
+
+// Fit scales img to fit on the device's panel, keeping its aspect ratio, and
+// turns it by the device's rotation. The space left over is filled with background.
+func (d Device) Fit(img image.Image, background color.Color) image.Image {
+	width, height := d.Size()
+
+	bounds := img.Bounds()
+	fitted := img
+	if bounds.Dx() != width || bounds.Dy() != height {
+		scale := float64(width) / float64(bounds.Dx())
+		if s := float64(height) / float64(bounds.Dy()); s < scale {
+			scale = s
+		}
+		w, h := int(float64(bounds.Dx())*scale+0.5), int(float64(bounds.Dy())*scale+0.5)
+		x, y := (width-w)/2, (height-h)/2
+
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, image.Rect(x, y, x+w, y+h), img, bounds, draw.Over, nil)
+		fitted = dst
+	}
+
+	return rotate(fitted, d.Rotation)
+}
+
+// rotate turns img clockwise by degrees, which is 0, 90, 180 or 270.
+func rotate(img image.Image, degrees int) image.Image {
+	if degrees%360 == 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	rect := image.Rect(0, 0, w, h)
+	if degrees == 90 || degrees == 270 {
+		rect = image.Rect(0, 0, h, w)
+	}
+
+	dst := image.NewRGBA(rect)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			switch degrees {
+			case 90:
+				dst.Set(h-1-y, x, c)
+			case 180:
+				dst.Set(w-1-x, h-1-y, c)
+			case 270:
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+	return dst
+}
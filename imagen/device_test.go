@@ -0,0 +1,84 @@
+package imagen
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDevicesPalettesFormats(t *testing.T) {
+	for _, name := range DeviceNames() {
+		device, err := LoadDevice(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if device.Palette == nil {
+			t.Errorf("%s: no palette", name)
+			continue
+		}
+		if len(device.Palette.Colors) > 1<<device.BitDepth {
+			t.Errorf("%s: %d inks don't fit in %d bits", name, len(device.Palette.Colors), device.BitDepth)
+		}
+		if device.Format != FormatJPEG && len(device.Palette.Colors) == 0 {
+			t.Errorf("%s: grayscale images should be JPEGs", name)
+		}
+	}
+}
+
+func TestDeviceFit(t *testing.T) {
+	dashboard := image.NewRGBA(image.Rect(0, 0, 1200, 825))
+
+	tests := []struct {
+		device Device
+		want   image.Rectangle
+	}{
+		{device: Device{Width: 1200, Height: 825}, want: dashboard.Bounds()},
+		{device: Device{Width: 800, Height: 480}, want: image.Rect(0, 0, 800, 480)},
+		{device: Device{Width: 600, Height: 800, Rotation: 90}, want: image.Rect(0, 0, 600, 800)},
+		{device: Device{Width: 600, Height: 800, Rotation: 180}, want: image.Rect(0, 0, 600, 800)},
+	}
+
+	for _, tc := range tests {
+		if got := tc.device.Fit(dashboard, color.White).Bounds(); got != tc.want {
+			t.Errorf("fitting on %dx%d turned by %d: got %v, want %v", tc.device.Width, tc.device.Height, tc.device.Rotation, got, tc.want)
+		}
+	}
+}
+
+func TestDeviceSize(t *testing.T) {
+	tests := []struct {
+		device                Device
+		wantWidth, wantHeight int
+	}{
+		{device: Device{Width: 800, Height: 480}, wantWidth: 800, wantHeight: 480},
+		{device: Device{Width: 600, Height: 800, Rotation: 90}, wantWidth: 800, wantHeight: 600},
+		{device: Device{Width: 600, Height: 800, Rotation: 180}, wantWidth: 600, wantHeight: 800},
+	}
+
+	for _, tc := range tests {
+		if width, height := tc.device.Size(); width != tc.wantWidth || height != tc.wantHeight {
+			t.Errorf("%dx%d turned by %d: got %dx%d, want %dx%d", tc.device.Width, tc.device.Height, tc.device.Rotation, width, height, tc.wantWidth, tc.wantHeight)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{Y: 255})
+
+	tests := []struct {
+		degrees int
+		want    image.Point
+	}{
+		{degrees: 90, want: image.Pt(0, 0)},
+		{degrees: 180, want: image.Pt(1, 0)},
+		{degrees: 270, want: image.Pt(0, 1)},
+	}
+
+	for _, tc := range tests {
+		rotated := rotate(img, tc.degrees)
+		if r, _, _, _ := rotated.At(tc.want.X, tc.want.Y).RGBA(); r != 0xffff {
+			t.Errorf("rotating by %d: the white pixel isn't at %v", tc.degrees, tc.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package imagen
+
+import (
+	"image"
+	"sort"
+)
+
+const (
+	// diffCellSize is the size of the squares images are compared in. Regions
+	// are made of whole cells, so they line up with the bytes of 1-bit panels.
+	diffCellSize = 16
+	// maxDiffPortion is how much of the image can change before it's cheaper
+	// to refresh all of it.
+	maxDiffPortion = 0.5
+)
+
+// DiffRegions returns the rectangles of cur that changed since prev, for
+// displays that can refresh part of the screen. It returns the bounds of cur
+// when all of it should be refreshed: when there's no prev, the sizes differ,
+// or most of the image changed.
+func DiffRegions(prev, cur image.Image) []image.Rectangle {
+	bounds := cur.Bounds()
+	if prev == nil || prev.Bounds() != bounds {
+		return []image.Rectangle{bounds}
+	}
+
+	cols := (bounds.Dx() + diffCellSize - 1) / diffCellSize
+	rows := (bounds.Dy() + diffCellSize - 1) / diffCellSize
+	changed := make([]bool, cols*rows)
+	anyChanged := false
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if cellChanged(prev, cur, cellBounds(bounds, col, row)) {
+				changed[row*cols+col] = true
+				anyChanged = true
+			}
+		}
+	}
+	if !anyChanged {
+		return nil
+	}
+
+	// Group neighbouring cells into regions.
+	var regions []image.Rectangle
+	seen := make([]bool, len(changed))
+	for start := range changed {
+		if !changed[start] || seen[start] {
+			continue
+		}
+		region := image.Rectangle{}
+		stack := []int{start}
+		seen[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			col, row := i%cols, i/cols
+			region = region.Union(cellBounds(bounds, col, row))
+
+			for _, n := range [][2]int{{col - 1, row}, {col + 1, row}, {col, row - 1}, {col, row + 1}} {
+				if n[0] < 0 || n[0] >= cols || n[1] < 0 || n[1] >= rows {
+					continue
+				}
+				j := n[1]*cols + n[0]
+				if changed[j] && !seen[j] {
+					seen[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		regions = append(regions, region)
+	}
+
+	regions = mergeOverlapping(regions)
+	area := 0
+	for _, r := range regions {
+		area += r.Dx() * r.Dy()
+	}
+	if float64(area) > maxDiffPortion*float64(bounds.Dx()*bounds.Dy()) {
+		return []image.Rectangle{bounds}
+	}
+
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].Min.Y != regions[j].Min.Y {
+			return regions[i].Min.Y < regions[j].Min.Y
+		}
+		return regions[i].Min.X < regions[j].Min.X
+	})
+	return regions
+}
+
+// mergeOverlapping merges the bounding boxes of regions until none of them overlap.
+func mergeOverlapping(regions []image.Rectangle) []image.Rectangle {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(regions) && !merged; i++ {
+			for j := i + 1; j < len(regions); j++ {
+				if regions[i].Overlaps(regions[j]) {
+					regions[i] = regions[i].Union(regions[j])
+					regions = append(regions[:j], regions[j+1:]...)
+					merged = true
+					break
+				}
+			}
+		}
+	}
+	return regions
+}
+
+func cellBounds(bounds image.Rectangle, col, row int) image.Rectangle {
+	min := bounds.Min.Add(image.Pt(col*diffCellSize, row*diffCellSize))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(diffCellSize, diffCellSize))}.Intersect(bounds)
+}
+
+func cellChanged(prev, cur image.Image, cell image.Rectangle) bool {
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			r1, g1, b1, a1 := prev.At(x, y).RGBA()
+			r2, g2, b2, a2 := cur.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package imagen
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestDiffRegions(t *testing.T) {
+	blank := func() *image.Gray {
+		img := image.NewGray(image.Rect(0, 0, 200, 100))
+		for i := range img.Pix {
+			img.Pix[i] = 255
+		}
+		return img
+	}
+	with := func(points ...image.Point) *image.Gray {
+		img := blank()
+		for _, p := range points {
+			img.SetGray(p.X, p.Y, color.Gray{})
+		}
+		return img
+	}
+	fill := func(r image.Rectangle) *image.Gray {
+		img := blank()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetGray(x, y, color.Gray{})
+			}
+		}
+		return img
+	}
+
+	tests := []struct {
+		name string
+		prev image.Image
+		cur  image.Image
+		want []image.Rectangle
+	}{
+		{
+			name: "nothing to compare with",
+			cur:  blank(),
+			want: []image.Rectangle{image.Rect(0, 0, 200, 100)},
+		},
+		{
+			name: "different sizes",
+			prev: image.NewGray(image.Rect(0, 0, 100, 100)),
+			cur:  blank(),
+			want: []image.Rectangle{image.Rect(0, 0, 200, 100)},
+		},
+		{
+			name: "unchanged",
+			prev: blank(),
+			cur:  blank(),
+		},
+		{
+			name: "one pixel",
+			prev: blank(),
+			cur:  with(image.Pt(20, 5)),
+			want: []image.Rectangle{image.Rect(16, 0, 32, 16)},
+		},
+		{
+			name: "neighbouring cells are one region",
+			prev: blank(),
+			cur:  with(image.Pt(20, 5), image.Pt(35, 5), image.Pt(35, 20)),
+			want: []image.Rectangle{image.Rect(16, 0, 48, 32)},
+		},
+		{
+			name: "separate regions",
+			prev: blank(),
+			cur:  with(image.Pt(5, 5), image.Pt(150, 90)),
+			want: []image.Rectangle{image.Rect(0, 0, 16, 16), image.Rect(144, 80, 160, 96)},
+		},
+		{
+			name: "the last cells are cut to the image",
+			prev: blank(),
+			cur:  with(image.Pt(199, 99)),
+			want: []image.Rectangle{image.Rect(192, 96, 200, 100)},
+		},
+		{
+			name: "most of the image changed",
+			prev: blank(),
+			cur:  fill(image.Rect(0, 0, 150, 100)),
+			want: []image.Rectangle{image.Rect(0, 0, 200, 100)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DiffRegions(tc.prev, tc.cur); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package imagen
+
+import (
+	"image"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	errorIconSize = 120.0
+	errorMargin   = 80.0
+
+	// cardHeight is the height the error and night cards are laid out for.
+	// They are shrunk to fit on shorter panels.
+	cardHeight = 825.0
+)
+
+// cardScale returns how much the error and night cards are shrunk by to fit
+// in height.
+func cardScale(height float64) float64 {
+	if height >= cardHeight {
+		return 1
+	}
+	return height / cardHeight
+}
+
+// GenerateErrorImage draws a width x height card explaining why the dashboard
+// couldn't be rendered. hint says what to do about it, and details is the
+// underlying error.
+func GenerateErrorImage(fonts *Fonts, theme *Theme, title, hint, details string, width, height float64) image.Image {
+	errCtx := gg.NewContext(int(width), int(height))
+	errCtx.SetColor(theme.Background)
+	errCtx.Clear()
+
+	scale := cardScale(height)
+	margin, iconSize := errorMargin*scale, errorIconSize*scale
+
+	errCtx.SetColor(theme.Foreground)
+	errCtx.SetLineWidth(theme.InnerBoundaryWidth)
+	errCtx.DrawRoundedRectangle(margin/2, margin/2, width-margin, height-margin, 2*theme.CornerRadius)
+	errCtx.Stroke()
+
+	top := margin * 1.5
+	drawWarningIcon(errCtx, (width-iconSize)/2, top, iconSize, theme.Background)
+	top += iconSize + 40*scale
+
+	textWidth := width - 4*margin
+	textX := 2 * margin
+	top += textBlock{text: title, style: Bold, size: 40 * scale, maxLines: 2, ax: 0.5}.draw(errCtx, fonts, textX, top, textWidth, 0)
+	top += 20 * scale
+
+	top += textBlock{text: hint, style: Regular, size: 26 * scale, maxLines: 3, ax: 0.5}.draw(errCtx, fonts, textX, top, textWidth, 0)
+	top += 30 * scale
+
+	// The details are for whoever reads the logs, so keep them small and at the bottom.
+	detailsBlock := textBlock{text: details, style: Regular, size: 18 * scale, minSize: 12 * scale, ax: 0.5}
+	detailsBlock.draw(errCtx, fonts, textX, top, textWidth, height-margin-top)
+
+	return errCtx.Image()
+}
@@ -0,0 +1,105 @@
+package imagen
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+)
+
+// eventLayout is where an event is drawn within its day column. The column is
+// split into columns equal parts and the event covers span of them, starting at
+// column.
+type eventLayout struct {
+	event   gcalendar.Event
+	column  int
+	span    int
+	columns int
+}
+
+// layoutEvents packs the events into columns so that overlapping events are
+// drawn side by side, the same way Google Calendar does it:
+//
+//  1. Events are sorted by start time, longer events first.
+//  2. Events that overlap, directly or through a chain of other events, form a
+//     cluster. All the events in a cluster share the same number of columns.
+//  3. Every event goes into the leftmost column that is free when it starts.
+//  4. Events then expand into the columns to their right that are free for
+//     their whole duration.
+//
+// Events that end exactly when another one starts don't overlap.
+func layoutEvents(events []gcalendar.Event) []eventLayout {
+	sorted := append([]gcalendar.Event(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Start.Equal(sorted[j].Start) {
+			return sorted[i].Start.Before(sorted[j].Start)
+		}
+		return sorted[i].End.After(sorted[j].End)
+	})
+
+	layouts := make([]eventLayout, 0, len(sorted))
+
+	var (
+		cluster    []eventLayout
+		columnEnds []time.Time
+		clusterEnd time.Time
+	)
+	flush := func() {
+		for i := range cluster {
+			cluster[i].columns = len(columnEnds)
+			cluster[i].span = freeColumns(cluster, i)
+		}
+		layouts = append(layouts, cluster...)
+
+		cluster = nil
+		columnEnds = nil
+	}
+
+	for _, event := range sorted {
+		if len(cluster) > 0 && !event.Start.Before(clusterEnd) {
+			flush()
+		}
+
+		column := -1
+		for i, end := range columnEnds {
+			if !event.Start.Before(end) {
+				column = i
+				break
+			}
+		}
+		if column == -1 {
+			column = len(columnEnds)
+			columnEnds = append(columnEnds, event.End)
+		} else {
+			columnEnds[column] = event.End
+		}
+
+		cluster = append(cluster, eventLayout{event: event, column: column})
+		if len(cluster) == 1 || event.End.After(clusterEnd) {
+			clusterEnd = event.End
+		}
+	}
+	flush()
+
+	return layouts
+}
+
+// freeColumns returns the number of columns the event at index i in the
+// cluster can cover, starting at its own column.
+func freeColumns(cluster []eventLayout, i int) int {
+	event := cluster[i]
+	span := 1
+	for column := event.column + 1; column < event.columns; column++ {
+		for _, other := range cluster {
+			if other.column == column && eventsOverlap(event.event, other.event) {
+				return span
+			}
+		}
+		span++
+	}
+	return span
+}
+
+func eventsOverlap(a, b gcalendar.Event) bool {
+	return a.Start.Before(b.End) && b.Start.Before(a.End)
+}
@@ -0,0 +1,169 @@
+package imagen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+)
+
+func TestLayoutEvents(t *testing.T) {
+	base := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+	event := func(title string, start, end time.Duration) gcalendar.Event {
+		return gcalendar.Event{Title: title, Start: base.Add(start), End: base.Add(end)}
+	}
+
+	// position is the expected column, span and number of columns of an event.
+	type position struct {
+		column, span, columns int
+	}
+
+	tests := []struct {
+		name   string
+		events []gcalendar.Event
+		want   map[string]position
+	}{
+		{
+			name: "no events",
+			want: map[string]position{},
+		},
+		{
+			name: "back to back events don't overlap",
+			events: []gcalendar.Event{
+				event("a", 0, time.Hour),
+				event("b", time.Hour, 2*time.Hour),
+			},
+			want: map[string]position{
+				"a": {0, 1, 1},
+				"b": {0, 1, 1},
+			},
+		},
+		{
+			name: "two overlapping events",
+			events: []gcalendar.Event{
+				event("a", 0, time.Hour),
+				event("b", 30*time.Minute, 90*time.Minute),
+			},
+			want: map[string]position{
+				"a": {0, 1, 2},
+				"b": {1, 1, 2},
+			},
+		},
+		{
+			name: "chain reuses the first column",
+			events: []gcalendar.Event{
+				event("a", 0, time.Hour),
+				event("b", 30*time.Minute, 90*time.Minute),
+				event("c", time.Hour, 2*time.Hour),
+			},
+			want: map[string]position{
+				"a": {0, 1, 2},
+				"b": {1, 1, 2},
+				"c": {0, 1, 2},
+			},
+		},
+		{
+			name: "chain compared against the whole cluster, not the first event",
+			events: []gcalendar.Event{
+				event("a", 0, 30*time.Minute),
+				event("b", 15*time.Minute, 2*time.Hour),
+				event("c", time.Hour, 90*time.Minute),
+			},
+			want: map[string]position{
+				"a": {0, 1, 2},
+				"b": {1, 1, 2},
+				"c": {0, 1, 2},
+			},
+		},
+		{
+			name: "nested events",
+			events: []gcalendar.Event{
+				event("b", 30*time.Minute, time.Hour),
+				event("a", 0, 3*time.Hour),
+				event("c", 2*time.Hour, 150*time.Minute),
+			},
+			want: map[string]position{
+				"a": {0, 1, 2},
+				"b": {1, 1, 2},
+				"c": {1, 1, 2},
+			},
+		},
+		{
+			name: "same start puts the longer event first",
+			events: []gcalendar.Event{
+				event("short", 0, 30*time.Minute),
+				event("long", 0, 2*time.Hour),
+			},
+			want: map[string]position{
+				"long":  {0, 1, 2},
+				"short": {1, 1, 2},
+			},
+		},
+		{
+			name: "five way overlap",
+			events: []gcalendar.Event{
+				event("a", 0, time.Hour),
+				event("b", 0, time.Hour),
+				event("c", 0, time.Hour),
+				event("d", 0, time.Hour),
+				event("e", 0, time.Hour),
+			},
+			want: map[string]position{
+				"a": {0, 1, 5},
+				"b": {1, 1, 5},
+				"c": {2, 1, 5},
+				"d": {3, 1, 5},
+				"e": {4, 1, 5},
+			},
+		},
+		{
+			name: "events expand into free columns",
+			events: []gcalendar.Event{
+				event("a", 0, 2*time.Hour),
+				event("b", 0, time.Hour),
+				event("c", 0, 30*time.Minute),
+				event("d", time.Hour, 2*time.Hour),
+			},
+			want: map[string]position{
+				"a": {0, 1, 3},
+				"b": {1, 1, 3},
+				"c": {2, 1, 3},
+				"d": {1, 2, 3},
+			},
+		},
+		{
+			name: "separate clusters get their own columns",
+			events: []gcalendar.Event{
+				event("a", 0, time.Hour),
+				event("b", 0, time.Hour),
+				event("c", 0, time.Hour),
+				event("d", 2*time.Hour, 3*time.Hour),
+			},
+			want: map[string]position{
+				"a": {0, 1, 3},
+				"b": {1, 1, 3},
+				"c": {2, 1, 3},
+				"d": {0, 1, 1},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			layouts := layoutEvents(tc.events)
+			if len(layouts) != len(tc.want) {
+				t.Fatalf("got %d layouts, want %d", len(layouts), len(tc.want))
+			}
+
+			for _, layout := range layouts {
+				got := position{layout.column, layout.span, layout.columns}
+				if want := tc.want[layout.event.Title]; got != want {
+					t.Errorf("event %q: got %+v, want %+v", layout.event.Title, got, want)
+				}
+				if layout.column+layout.span > layout.columns {
+					t.Errorf("event %q is drawn outside the panel: %+v", layout.event.Title, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package imagen
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Style is a variant of the typeface used to draw the dashboard.
+type Style int
+
+const (
+	Regular Style = iota
+	// Bold is used for headers.
+	Bold
+	// Italic is used for secondary text, like event descriptions.
+	Italic
+)
+
+// Fonts holds the typefaces used to draw the dashboard, and caches their faces
+// by style and size.
+type Fonts struct {
+	chains map[Style][]*sfnt.Font
+
+	mtx   sync.Mutex
+	faces map[faceKey]font.Face
+}
+
+type faceKey struct {
+	style Style
+	size  float64
+}
+
+// NewFonts loads the TTF, OTF or TTC font files once. regular is the fallback
+// chain for regular text: glyphs missing from the first font are taken from the
+// next one, and the embedded Go font is used last. bold and italic replace the
+// Go bold and italic fonts when set, and fall back to the regular chain.
+func NewFonts(regular []string, bold, italic string) (*Fonts, error) {
+	goRegular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*sfnt.Font
+	for _, path := range regular {
+		f, err := loadFont(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+	chain = append(chain, goRegular)
+
+	variant := func(path string, embedded []byte) ([]*sfnt.Font, error) {
+		var (
+			f   *sfnt.Font
+			err error
+		)
+		if path != "" {
+			f, err = loadFont(path)
+		} else {
+			f, err = opentype.Parse(embedded)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]*sfnt.Font{f}, chain...), nil
+	}
+	boldChain, err := variant(bold, gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	italicChain, err := variant(italic, goitalic.TTF)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fonts{
+		chains: map[Style][]*sfnt.Font{
+			Regular: chain,
+			Bold:    boldChain,
+			Italic:  italicChain,
+		},
+		faces: map[faceKey]font.Face{},
+	}, nil
+}
+
+// loadFont parses a font file. Only the first font of a collection is used.
+func loadFont(path string) (*sfnt.Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read font: %w", err)
+	}
+
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse font %s: %w", path, err)
+	}
+	f, err := collection.Font(0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse font %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Face returns the face for text of the given style and size. Faces are shared,
+// so they must not be used by several renders at once.
+func (f *Fonts) Face(style Style, size float64) font.Face {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	key := faceKey{style: style, size: size}
+	if face, ok := f.faces[key]; ok {
+		return face
+	}
+
+	face := &fallbackFace{}
+	for _, fnt := range f.chains[style] {
+		fntFace, err := opentype.NewFace(fnt, &opentype.FaceOptions{Size: size, DPI: 72})
+		if err != nil {
+			continue
+		}
+		face.fonts = append(face.fonts, fnt)
+		face.faces = append(face.faces, fntFace)
+	}
+	f.faces[key] = face
+	return face
+}
+
+// fallbackFace draws every glyph with the first font that has it, so text in
+// scripts the main font doesn't cover is still readable.
+type fallbackFace struct {
+	fonts []*sfnt.Font
+	faces []font.Face
+	buf   sfnt.Buffer
+}
+
+// faceFor returns the face that has a glyph for r and the rune to draw. Runes
+// no font has are drawn as U+FFFD, as the .notdef glyphs are often empty.
+func (f *fallbackFace) faceFor(r rune) (font.Face, rune) {
+	for _, r := range []rune{r, utf8.RuneError} {
+		for i, fnt := range f.fonts {
+			if x, err := fnt.GlyphIndex(&f.buf, r); err == nil && x != 0 {
+				return f.faces[i], r
+			}
+		}
+	}
+	return f.faces[0], r
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	face, r := f.faceFor(r)
+	return face.Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	face, r := f.faceFor(r)
+	return face.GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	face, r := f.faceFor(r)
+	return face.GlyphAdvance(r)
+}
+
+// Kern only kerns pairs of glyphs from the same font.
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face0, r0 := f.faceFor(r0)
+	face1, r1 := f.faceFor(r1)
+	if face0 != face1 {
+		return 0
+	}
+	return face0.Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
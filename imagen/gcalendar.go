@@ -2,152 +2,433 @@ package imagen
 
 import (
 	"fmt"
+	"html"
 	"image"
 	"image/color"
-	"log"
+	"math"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/fogleman/gg"
-	"github.com/golang/freetype/truetype"
 	"github.com/gouthamve/gophercal/gcalendar"
-	"golang.org/x/image/font/gofont/goregular"
 )
 
-// The inkplate is 1200x825. 50% of it would be calendar, hence 600x825
 const (
-	maxHours  = 8
-	calWidth  = 600.0
-	calHeight = 825.0
+	// Views with several days get a header with the date above each column.
+	dayHeaderHeight = 40.0
 
-	hourHeight float64 = calHeight / maxHours
+	eventPadding           = 4.0
+	continuationMarkerSize = 10
+	minEventFontSize       = 10.0
+
+	// Hours shorter than minHourHeight, on small panels or in views with
+	// several days, get the smaller labels and event text.
+	minHourHeight = 60.0
+
+	// nowNextHorizon is how far ahead the now/next panel looks for the next
+	// event, past the end of the view, so it sees tonight's and the next days' events.
+	nowNextHorizon = 3 * 24 * time.Hour
 )
 
-func GenerateCalendarImage(events []gcalendar.Event, location string) image.Image {
-	font, err := truetype.Parse(goregular.TTF)
-	if err != nil {
-		log.Fatal(err)
+// CalendarViewMode selects how much of the calendar is drawn.
+type CalendarViewMode string
+
+const (
+	// ViewRolling shows Hours hours, starting an hour before now.
+	ViewRolling CalendarViewMode = "rolling"
+	// ViewWorkday shows today from DayStart to DayEnd.
+	ViewWorkday CalendarViewMode = "workday"
+	// ViewThreeDay shows today and the next two days side by side.
+	ViewThreeDay CalendarViewMode = "3day"
+	// ViewWeek shows the next seven days side by side.
+	ViewWeek CalendarViewMode = "week"
+	// ViewAgenda lists the events in the next Hours hours.
+	ViewAgenda CalendarViewMode = "agenda"
+)
+
+// CalendarView describes the part of the calendar that is drawn.
+type CalendarView struct {
+	Mode CalendarViewMode
+
+	// Hours is the length of the rolling view.
+	Hours int
+	// DayStart and DayEnd are the hours shown in every other view.
+	DayStart int
+	DayEnd   int
+
+	// AgendaThreshold switches to the agenda when more than this many events
+	// overlap. It's disabled when 0.
+	AgendaThreshold int
+
+	// NowNext adds the now/next panel above the calendar.
+	NowNext bool
+}
+
+// Days returns the number of day columns in the view.
+func (v CalendarView) Days() int {
+	switch v.Mode {
+	case ViewThreeDay:
+		return 3
+	case ViewWeek:
+		return 7
+	}
+	return 1
+}
+
+// Window returns the time range events have to be fetched for at now. It's the
+// drawn part of the calendar, plus what the now/next panel needs.
+func (v CalendarView) Window(now time.Time) (time.Time, time.Time) {
+	start, end := v.visible(now)
+	if v.NowNext {
+		// The now/next panel needs the event that's happening now, even
+		// before the day starts, and the next one, even after it ends.
+		if now.Before(start) {
+			start = now
+		}
+		if horizon := now.Add(nowNextHorizon); end.Before(horizon) {
+			end = horizon
+		}
+	}
+	return start, end
+}
+
+// visible returns the time range drawn at now.
+func (v CalendarView) visible(now time.Time) (time.Time, time.Time) {
+	if v.Mode == ViewAgenda {
+		return now, addHours(now, v.Hours)
+	}
+
+	start, _ := v.column(now, 0)
+	last, hours := v.column(now, v.Days()-1)
+	return start, addHours(last, hours)
+}
+
+// addHours adds hours to the wall clock time of t, so days with a daylight
+// saving change still end at the same hour.
+func addHours(t time.Time, hours int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+hours, t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// column returns the start and the number of hours of the day column at index day.
+func (v CalendarView) column(now time.Time, day int) (time.Time, int) {
+	if v.Mode == ViewRolling || v.Mode == ViewAgenda || v.Mode == "" {
+		// Start from the previous hour.
+		start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour()-1, 0, 0, 0, now.Location())
+		return start, v.Hours
 	}
-	face := truetype.NewFace(font, &truetype.Options{Size: 20})
 
-	calCtx := gg.NewContext(calWidth, calHeight)
-	calCtx.SetFontFace(face)
+	start := time.Date(now.Year(), now.Month(), now.Day()+day, v.DayStart, 0, 0, 0, now.Location())
+	return start, v.DayEnd - v.DayStart
+}
+
+// GenerateCalendarImage draws the width x height calendar panel as it looks at
+// now, in the time zone of now.
+func GenerateCalendarImage(fonts *Fonts, theme *Theme, events []gcalendar.Event, view CalendarView, now time.Time, width, height float64) image.Image {
+	calWidth, calHeight := width, height
+	calCtx := gg.NewContext(int(calWidth), int(calHeight))
 
 	// White background
 	calCtx.DrawRectangle(0, 0, calWidth, calHeight)
-	calCtx.SetRGB(1, 1, 1)
+	calCtx.SetColor(theme.Background)
 	calCtx.Fill()
 
-	calCtx.SetRGB(0, 0, 0)
-	// Start from the previous hour.
-	loc := time.Local
-	if location != "" {
-		loc, err = time.LoadLocation(location)
-		if err != nil {
-			log.Fatal(err)
+	calCtx.SetColor(theme.Foreground)
+	top := 0.0
+	if view.NowNext {
+		calCtx.DrawImage(GenerateNowNextImage(fonts, theme, events, now, calWidth, nowNextHeight), 0, 0)
+		top = nowNextHeight
+	}
+
+	// The events past the view are only fetched for the now/next panel.
+	visibleStart, visibleEnd := view.visible(now)
+	events = eventsBetween(events, visibleStart, visibleEnd)
+	if view.Mode == ViewAgenda || (view.AgendaThreshold > 0 && maxConcurrentEvents(events) > view.AgendaThreshold) {
+		drawAgenda(calCtx, fonts, theme, events, now, top)
+		return calCtx.Image()
+	}
+
+	days := view.Days()
+	if days > 1 {
+		top += dayHeaderHeight
+	}
+	columnWidth := calWidth / float64(days)
+
+	for day := 0; day < days; day++ {
+		colStart, hours := view.column(now, day)
+		xStart := float64(day) * columnWidth
+
+		if days > 1 {
+			calCtx.SetFontFace(fonts.Face(Bold, 20))
+			label := truncateString(calCtx, colStart.Format("Mon 2"), columnWidth)
+			drawText(calCtx, label, xStart+columnWidth/2, top-dayHeaderHeight/2, 0.5, 0.5)
+		}
+
+		dayEvents := eventsBetween(events, colStart, addHours(colStart, hours))
+		col := dayColumn{
+			x:      xStart,
+			y:      top,
+			width:  columnWidth,
+			height: calHeight - top,
+			start:  colStart,
+			hours:  hours,
+			labels: day == 0,
 		}
+		col.draw(calCtx, fonts, theme, dayEvents, now, days > 1)
 	}
 
-	hours, minutes, _ := time.Now().In(loc).Clock()
-	startHour := hours - 1
+	return calCtx.Image()
+}
+
+// eventsBetween returns the events that are happening between start and end.
+func eventsBetween(events []gcalendar.Event, start, end time.Time) []gcalendar.Event {
+	var between []gcalendar.Event
+	for _, event := range events {
+		if event.Start.Before(end) && event.End.After(start) {
+			between = append(between, event)
+		}
+	}
+	return between
+}
+
+// dayColumn is the area of the calendar panel that shows hours hours on the
+// wall clock starting at start.
+type dayColumn struct {
+	x, y          float64
+	width, height float64
+
+	start  time.Time
+	hours  int
+	labels bool
+}
+
+// hour returns the start of the i-th hour of the column.
+func (c dayColumn) hour(i int) time.Time {
+	return addHours(c.start, i)
+}
+
+func (c dayColumn) end() time.Time {
+	return c.hour(c.hours)
+}
+
+// hourHeight is the height of an hour. On days with a daylight saving change
+// the column has an hour more or less than c.hours in it.
+func (c dayColumn) hourHeight() float64 {
+	return c.height / c.end().Sub(c.start).Hours()
+}
+
+// offset returns the y coordinate of t in the column.
+func (c dayColumn) offset(t time.Time) float64 {
+	return c.y + t.Sub(c.start).Hours()*c.hourHeight()
+}
+
+func (c dayColumn) draw(calCtx *gg.Context, fonts *Fonts, theme *Theme, events []gcalendar.Event, now time.Time, compact bool) {
+	hourHeight := c.hourHeight()
+	labelSize, eventSize := 25.0, 20.0
+	if compact || hourHeight < minHourHeight {
+		labelSize, eventSize = 16, 14
+	}
 
 	// Draw the line for the current time.
-	calCtx.SetLineWidth(lineWidth * 1.5)
-	yStart := float64(hours-startHour)*hourHeight + float64(minutes)/60*hourHeight
-	calCtx.SetDash(10, 7)
-	calCtx.DrawLine(0, yStart, calWidth, yStart)
-	calCtx.Stroke()
-	// TODO: Fill the dashes with white color for better visibility.
-	// calCtx.SetRGB(1, 1, 1)
-	// calCtx.SetLineWidth(lineWidth)
-	// calCtx.SetDash(7, 7)
-
-	calCtx.SetDash()
+	if !now.Before(c.start) && now.Before(c.end()) {
+		calCtx.SetLineWidth(theme.LineWidth * 1.5)
+		yStart := c.offset(now)
+		calCtx.SetDash(10, 7)
+		calCtx.DrawLine(c.x, yStart, c.x+c.width, yStart)
+		calCtx.Stroke()
+		// TODO: Fill the dashes with white color for better visibility.
+		// calCtx.SetRGB(1, 1, 1)
+		// calCtx.SetLineWidth(lineWidth)
+		// calCtx.SetDash(7, 7)
+
+		calCtx.SetDash()
+	}
 
 	// Draw the hour lines.
-	for i := 0; i < maxHours; i++ {
-		yStart := float64(i) * calHeight / maxHours
-		timeFace := truetype.NewFace(font, &truetype.Options{Size: 25})
-		calCtx.SetFontFace(timeFace)
-		calCtx.DrawStringAnchored(fmt.Sprintf("%d:00", (startHour+i)%24), 0, yStart, 0, 1)
-		calCtx.SetFontFace(face)
-
-		rectangleWidth := calWidth - 2*outsideBoundaryWidth
-		calCtx.SetLineWidth(lineWidth)
-		calCtx.DrawRoundedRectangle(outsideBoundaryWidth, yStart, rectangleWidth, hourHeight, 5)
+	timeFace := fonts.Face(Regular, labelSize)
+	calCtx.SetFontFace(timeFace)
+	labelWidth, _ := calCtx.MeasureString("00:00")
+	for i := 0; i < c.hours; i++ {
+		hour, next := c.hour(i), c.hour(i+1)
+		if !next.After(hour) {
+			// The hour is skipped when the clocks go forward.
+			continue
+		}
+		yStart, yEnd := c.offset(hour), c.offset(next)
+		if c.labels {
+			calCtx.SetFontFace(timeFace)
+			drawText(calCtx, fmt.Sprintf("%d:00", hour.Hour()), c.x, yStart, 0, 1)
+		}
+
+		rectangleWidth := c.width - 2*theme.OutsideBoundaryWidth
+		calCtx.SetLineWidth(theme.LineWidth)
+		calCtx.DrawRoundedRectangle(c.x+theme.OutsideBoundaryWidth, yStart, rectangleWidth, yEnd-yStart, theme.CornerRadius)
 		calCtx.Stroke()
 	}
-	// Group by overlapping events.
-	overlappingEvents := [][]gcalendar.Event{}
-
-	for _, event := range events {
-		overlapping := false
-		for i, group := range overlappingEvents {
-			if group[0].End.Before(event.Start) || group[0].End.Equal(event.Start) {
-				continue
-			}
-			overlappingEvents[i] = append(group, event)
-			overlapping = true
-			break
+	// Draw the events side by side when they overlap.
+	eventsWidth := c.width - 2*theme.OutsideBoundaryWidth
+	for _, layout := range layoutEvents(events) {
+		// Clip the events to the column, and mark the ones that continue outside of it.
+		start, end := layout.event.Start, layout.event.End
+		continuesAbove, continuesBelow := start.Before(c.start), end.After(c.end())
+		if continuesAbove {
+			start = c.start
+		}
+		if continuesBelow {
+			end = c.end()
 		}
-		if !overlapping {
-			overlappingEvents = append(overlappingEvents, []gcalendar.Event{event})
+
+		columnWidth := eventsWidth / float64(layout.columns)
+		xStart := c.x + theme.OutsideBoundaryWidth + float64(layout.column)*columnWidth
+		yStart := c.offset(start)
+		width := float64(layout.span) * columnWidth
+		height := end.Sub(start).Hours() * hourHeight
+
+		// Keep the text of events in the first column clear of the hour labels.
+		inset := 0.0
+		if c.labels && layout.column == 0 {
+			inset = labelWidth
 		}
+
+		img := drawEvent(fonts, theme, layout.event, width, height, eventSize, inset, continuesAbove, continuesBelow)
+
+		calCtx.DrawImage(img, int(xStart), int(yStart))
+	}
+}
+
+// drawEvent draws the event box. Multi-line text starts inset from the left edge.
+// continuesAbove and continuesBelow add arrows to the top and bottom edges when
+// the event doesn't fit in the visible hours.
+func drawEvent(fonts *Fonts, theme *Theme, event gcalendar.Event, width, height, fontSize, inset float64, continuesAbove, continuesBelow bool) image.Image {
+	evCtx := gg.NewContext(int(width), int(height))
+	evCtx.SetLineWidth(theme.LineWidth / 3)
+	evCtx.SetFontFace(fonts.Face(Regular, fontSize))
+
+	// background. Events that don't need us there are lighter.
+	var fill color.Color = theme.EventFill
+	if event.Optional || event.Transparent {
+		fill = theme.LightEventFill
+	}
+	if event.ResponseStatus == gcalendar.ResponseNeedsAction {
+		fill = color.Transparent
+	}
+	evCtx.DrawRectangle(0, 0, width, height)
+	evCtx.SetColor(fill)
+	evCtx.Fill()
+
+	// Events with a colour of their own get a stripe of it in front of the
+	// text, on displays that can show it.
+	stripe := 0.0
+	if ink, ok := eventInk(theme, event); ok {
+		drawColorStripe(evCtx, ink, inset, 0, 0, width, height, theme.CornerRadius)
+		stripe = colorStripeWidth
 	}
 
-	// Draw the events in the rectangles.
-	for _, events := range overlappingEvents {
-		for i, event := range events {
-			overlaps := len(events)
-			if overlaps > 3 {
-				overlaps = 3
-			}
+	evCtx.SetColor(theme.Foreground)
+	if event.ResponseStatus == gcalendar.ResponseTentative {
+		drawHatching(evCtx, width, height)
+	}
 
-			hourDiff := event.Start.Hour() - startHour
-			// This means its a new day, so add the difference.
-			if hourDiff < 0 {
-				hourDiff += 24
-			}
+	// Events we haven't responded to yet get a dashed outline.
+	if event.ResponseStatus == gcalendar.ResponseNeedsAction {
+		evCtx.SetLineWidth(theme.LineWidth)
+		evCtx.SetDash(6, 4)
+	}
+	evCtx.DrawRoundedRectangle(0, 0, width, height, theme.CornerRadius)
+	evCtx.Stroke()
+	evCtx.SetDash()
+	evCtx.SetLineWidth(theme.LineWidth / 3)
 
-			yStart := float64(hourDiff) * hourHeight
-			yStart += float64(event.Start.Minute()) / 60 * hourHeight
+	top, bottom := eventPadding, height-eventPadding
+	if continuesAbove {
+		drawContinuationMarker(evCtx, width/2, 0, 1)
+		top += continuationMarkerSize
+	}
+	if continuesBelow {
+		drawContinuationMarker(evCtx, width/2, height, -1)
+		bottom -= continuationMarkerSize
+	}
 
-			img := drawEvent(event, overlaps)
+	lineHeight := fontSize * lineSpacing
+	lines := int((bottom - top) / lineHeight)
+	if lines < 2 {
+		// Short events only get their title, shrunk to fit if needed.
+		title := textBlock{text: event.Title, style: Regular, size: fontSize, minSize: minEventFontSize, ax: 0.5, ay: 0.5}
+		title.draw(evCtx, fonts, inset+eventPadding+stripe, 0, width-inset-2*eventPadding-stripe, height)
 
-			calCtx.DrawImage(img, int(innerBoundaryWidth)+i*calWidth/len(events), int(yStart))
-		}
+		return evCtx.Image()
 	}
+	drawEventDetails(evCtx, fonts, fontSize, event, inset+stripe, top, width-inset-stripe, lineHeight, lines)
 
-	return calCtx.Image()
+	return evCtx.Image()
 }
 
-func drawEvent(event gcalendar.Event, overlaps int) image.Image {
-	font, err := truetype.Parse(goregular.TTF)
-	if err != nil {
-		log.Fatal(err)
+// drawEventDetails fills lines lines of width starting at (left, top) with the time range,
+// the title, the description and the location of the event, in that order of importance.
+func drawEventDetails(evCtx *gg.Context, fonts *Fonts, fontSize float64, event gcalendar.Event, left, top, width, lineHeight float64, lines int) {
+	textX := left + eventPadding
+	textWidth := width - 2*eventPadding
+	y := top
+
+	// The time range, with a camera at the end of the line if there's a video call.
+	timeWidth := textWidth
+	if event.HasConference {
+		timeWidth -= lineHeight
+		drawVideoIcon(evCtx, left+width-eventPadding-lineHeight, y, lineHeight)
 	}
-	face := truetype.NewFace(font, &truetype.Options{Size: 20})
+	drawText(evCtx, truncateString(evCtx, createTimeRangeText(event), timeWidth), textX, y+lineHeight/2, 0, 0.5)
+	y += lineHeight
+	remaining := lines - 1
 
-	hourHeight := calHeight / maxHours
-	height := event.End.Sub(event.Start).Minutes() / 60 * hourHeight
+	// The location goes on the last line if there's room for it and the title.
+	footer := event.Location != "" && remaining >= 2
+	if footer {
+		remaining--
+	}
 
-	width := (calWidth - 2*outsideBoundaryWidth) / overlaps
+	titleHeight := textBlock{text: event.Title, style: Regular, size: fontSize, maxLines: remaining}.draw(evCtx, fonts, textX, y, textWidth, 0)
+	y += titleHeight
+	remaining -= int(math.Round(titleHeight / lineHeight))
 
-	evCtx := gg.NewContext(width, int(height))
-	evCtx.SetLineWidth(lineWidth / 3)
-	evCtx.SetFontFace(face)
+	if snippet := descriptionSnippet(event.Description); snippet != "" && remaining > 0 {
+		textBlock{text: snippet, style: Italic, size: fontSize, maxLines: remaining}.draw(evCtx, fonts, textX, y, textWidth, 0)
+		evCtx.SetFontFace(fonts.Face(Regular, fontSize))
+	}
 
-	// background
-	evCtx.DrawRectangle(0, 0, calWidth, calHeight)
-	evCtx.SetColor(color.RGBA{0, 0, 0, 60})
-	evCtx.Fill()
+	if footer {
+		y = top + float64(lines-1)*lineHeight
+		drawPinIcon(evCtx, textX, y, lineHeight)
+		location := truncateString(evCtx, event.Location, textWidth-lineHeight)
+		drawText(evCtx, location, textX+lineHeight, y+lineHeight/2, 0, 0.5)
+	}
+}
 
-	evCtx.SetRGB(0, 0, 0)
-	evCtx.DrawRoundedRectangle(0, 0, float64(width), height, 5)
-	evCtx.Stroke()
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// descriptionSnippet turns the event description, which is often HTML, into a single line of text.
+func descriptionSnippet(description string) string {
+	text := html.UnescapeString(htmlTagRegexp.ReplaceAllString(description, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
 
-	eventName := truncateString(evCtx, event.Title, float64(width))
-	evCtx.DrawStringAnchored(eventName, float64(width)/2, height/2, 0.5, 0.5)
+// drawHatching covers the event box with diagonal lines.
+func drawHatching(evCtx *gg.Context, width, height float64) {
+	const spacing = 12.0
+
+	for x := -height; x < width; x += spacing {
+		evCtx.DrawLine(x, height, x+height, 0)
+	}
 	evCtx.Stroke()
+}
 
-	return evCtx.Image()
+// drawContinuationMarker draws an arrow with its tip on the edge at (x, y),
+// pointing up when direction is 1 and down when it's -1.
+func drawContinuationMarker(evCtx *gg.Context, x, y, direction float64) {
+	const size = continuationMarkerSize - 2
+
+	evCtx.MoveTo(x, y+direction*2)
+	evCtx.LineTo(x-size, y+direction*continuationMarkerSize)
+	evCtx.LineTo(x+size, y+direction*continuationMarkerSize)
+	evCtx.ClosePath()
+	evCtx.Fill()
 }
@@ -0,0 +1,103 @@
+package imagen
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCalendarViewWindow(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		name               string
+		view               CalendarView
+		now                time.Time
+		wantStart, wantEnd time.Time
+	}{
+		{
+			name:      "rolling",
+			view:      CalendarView{Mode: ViewRolling, Hours: 8},
+			now:       at(4, 9, 30),
+			wantStart: at(4, 8, 0),
+			wantEnd:   at(4, 16, 0),
+		},
+		{
+			name:      "three days",
+			view:      CalendarView{Mode: ViewThreeDay, DayStart: 8, DayEnd: 18},
+			now:       at(4, 9, 30),
+			wantStart: at(4, 8, 0),
+			wantEnd:   at(6, 18, 0),
+		},
+		{
+			name:      "the now/next panel looks past the end of the day",
+			view:      CalendarView{Mode: ViewWorkday, DayStart: 8, DayEnd: 18, NowNext: true},
+			now:       at(4, 20, 0),
+			wantStart: at(4, 8, 0),
+			wantEnd:   at(7, 20, 0),
+		},
+		{
+			name:      "the now/next panel looks before the start of the day",
+			view:      CalendarView{Mode: ViewWorkday, DayStart: 8, DayEnd: 18, NowNext: true},
+			now:       at(4, 6, 0),
+			wantStart: at(4, 6, 0),
+			wantEnd:   at(7, 6, 0),
+		},
+		{
+			name:      "a whole day when the clocks go forward",
+			view:      CalendarView{Mode: ViewWorkday, DayStart: 0, DayEnd: 24},
+			now:       at(31, 9, 0),
+			wantStart: at(31, 0, 0),
+			wantEnd:   time.Date(2024, time.April, 1, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:      "rolling over the clocks going forward",
+			view:      CalendarView{Mode: ViewRolling, Hours: 4},
+			now:       at(31, 1, 30),
+			wantStart: at(31, 0, 0),
+			wantEnd:   at(31, 4, 0),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end := tc.view.Window(tc.now)
+			if !start.Equal(tc.wantStart) || !end.Equal(tc.wantEnd) {
+				t.Errorf("got %s - %s, want %s - %s", start, end, tc.wantStart, tc.wantEnd)
+			}
+		})
+	}
+}
+
+func TestDayColumnHours(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+
+	// The clocks go forward from 2:00 to 3:00, so the column is 3 hours long.
+	col := dayColumn{
+		height: 300,
+		start:  time.Date(2024, time.March, 31, 0, 0, 0, 0, berlin),
+		hours:  4,
+	}
+	if got := col.hourHeight(); got != 100 {
+		t.Errorf("got hour height %v, want 100", got)
+	}
+
+	var labels []int
+	for i := 0; i < col.hours; i++ {
+		if hour := col.hour(i); col.hour(i + 1).After(hour) {
+			labels = append(labels, hour.Hour())
+		}
+	}
+	if want := []int{0, 1, 3}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("got hours %v, want %v", labels, want)
+	}
+}
@@ -0,0 +1,414 @@
+package imagen
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+	"github.com/gouthamve/gophercal/todoist"
+	"github.com/gouthamve/gophercal/weather"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenNow is the moment every golden image is rendered at.
+var goldenNow = time.Date(2024, time.March, 4, 10, 20, 0, 0, time.UTC)
+
+// The golden panels are the size they are on the default device: half of its
+// 1200x825 panel each.
+const (
+	panelWidth  = 600.0
+	panelHeight = 825.0
+)
+
+func TestCalendarGolden(t *testing.T) {
+	rolling := CalendarView{Mode: ViewRolling, Hours: 8, DayStart: 8, DayEnd: 18}
+
+	tests := []struct {
+		name   string
+		events []gcalendar.Event
+		view   CalendarView
+	}{
+		{
+			name: "empty_day",
+			view: rolling,
+		},
+		{
+			name: "overlaps",
+			events: []gcalendar.Event{
+				{Title: "Standup", Start: goldenAt(9, 30), End: goldenAt(10, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Design review", Start: goldenAt(10, 0), End: goldenAt(11, 30), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Interview", Start: goldenAt(10, 30), End: goldenAt(11, 30), ResponseStatus: gcalendar.ResponseTentative},
+				{Title: "Lunch", Start: goldenAt(11, 0), End: goldenAt(12, 0), ResponseStatus: gcalendar.ResponseNeedsAction},
+				{Title: "Focus", Start: goldenAt(11, 30), End: goldenAt(13, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "All hands", Start: goldenAt(14, 0), End: goldenAt(15, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Office hours", Start: goldenAt(14, 0), End: goldenAt(15, 0), Optional: true, ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Gym", Start: goldenAt(14, 0), End: goldenAt(15, 0), Transparent: true, ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Coffee", Start: goldenAt(14, 0), End: goldenAt(15, 0), ResponseStatus: gcalendar.ResponseAccepted},
+			},
+			view: rolling,
+		},
+		{
+			name: "long_titles",
+			events: []gcalendar.Event{
+				{
+					Title:          "Quarterly business review with the platform, infrastructure and developer experience teams",
+					Start:          goldenAt(10, 0),
+					End:            goldenAt(12, 0),
+					Location:       "Conference room on the fourth floor next to the kitchen",
+					Description:    "<p>Please read the <b>pre-read</b> before the meeting &amp; add your comments.</p>",
+					HasConference:  true,
+					ResponseStatus: gcalendar.ResponseAccepted,
+				},
+				{Title: "Averyveryverylongtitlewithoutanyspacesthatcannotbewrapped", Start: goldenAt(13, 0), End: goldenAt(14, 0), ResponseStatus: gcalendar.ResponseAccepted},
+			},
+			view: rolling,
+		},
+		{
+			// Only scripts the embedded Go font has glyphs for, so the golden
+			// doesn't lock in boxes for missing glyphs.
+			name: "non_ascii",
+			events: []gcalendar.Event{
+				{Title: "Café avec l'équipe", Start: goldenAt(10, 0), End: goldenAt(11, 0), Location: "Zürich", ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Встреча команды", Start: goldenAt(11, 0), End: goldenAt(12, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Εβδομαδιαία σύσκεψη", Start: goldenAt(13, 0), End: goldenAt(14, 0), ResponseStatus: gcalendar.ResponseAccepted},
+			},
+			view: rolling,
+		},
+		{
+			name: "clipped",
+			events: []gcalendar.Event{
+				{Title: "Offsite", Start: goldenAt(6, 0), End: goldenAt(10, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Night shift", Start: goldenAt(15, 0), End: goldenAt(23, 0), ResponseStatus: gcalendar.ResponseAccepted},
+			},
+			view: rolling,
+		},
+		{
+			name: "three_day_now_next",
+			events: []gcalendar.Event{
+				{Title: "Planning", Start: goldenAt(10, 0), End: goldenAt(11, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Retro", Start: goldenAt(14, 0), End: goldenAt(15, 0), ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Overnight deploy", Start: goldenAt(16, 0), End: goldenAt(34, 0), ResponseStatus: gcalendar.ResponseAccepted},
+			},
+			view: CalendarView{Mode: ViewThreeDay, DayStart: 8, DayEnd: 18, NowNext: true},
+		},
+		{
+			name: "agenda",
+			events: []gcalendar.Event{
+				{Title: "Planning", Start: goldenAt(10, 0), End: goldenAt(11, 0), Location: "Room 1", Attendees: make([]gcalendar.Attendee, 4), HasConference: true, ResponseStatus: gcalendar.ResponseAccepted},
+				{Title: "Retro", Start: goldenAt(14, 0), End: goldenAt(15, 0), ResponseStatus: gcalendar.ResponseTentative},
+				{Title: "Breakfast", Start: goldenAt(32, 0), End: goldenAt(33, 0), ResponseStatus: gcalendar.ResponseNeedsAction},
+			},
+			view: CalendarView{Mode: ViewAgenda, Hours: 48},
+		},
+	}
+
+	fonts, theme := testFonts(t), testTheme(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img := GenerateCalendarImage(fonts, theme, tc.events, tc.view, goldenNow, panelWidth, panelHeight)
+			assertGolden(t, "calendar_"+tc.name, img)
+		})
+	}
+}
+
+func TestTodoistGolden(t *testing.T) {
+	today := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	task := func(content, project string, days int) todoist.Task {
+		return todoist.Task{Id: content, Content: content, Project: project, Due: today.AddDate(0, 0, days)}
+	}
+	many := func(n int) []todoist.Task {
+		tasks := make([]todoist.Task, 0, n)
+		for i := 0; i < n; i++ {
+			tasks = append(tasks, task(fmt.Sprintf("Task %d", i), "Inbox", 0))
+		}
+		return tasks
+	}
+
+	parent := task("Plan the trip", "Home", 0)
+	parent.Subtasks = []todoist.Task{task("Book flights", "Home", 0), task("Find a hotel", "Home", 0)}
+	parent.Subtasks[1].Subtasks = []todoist.Task{task("Compare prices", "Home", 0)}
+
+	tests := []struct {
+		name    string
+		tasks   []todoist.Task
+		groupBy todoist.GroupBy
+	}{
+		{
+			name:    "empty",
+			groupBy: todoist.GroupByNone,
+		},
+		{
+			name: "subtasks_grouped_by_due",
+			tasks: []todoist.Task{
+				task("Renew passport", "Admin", -3),
+				parent,
+				task("Water the plants", "Home", 0),
+				task("Call mum", "Family", 1),
+				task("Taxes", "Admin", 5),
+			},
+			groupBy: todoist.GroupByDue,
+		},
+		{
+			name: "long_titles",
+			tasks: []todoist.Task{
+				task("Write the design document for the new notification pipeline and share it with the team", "A project with a long name", 0),
+				task("https://example.com/a/very/long/link/that/does/not/have/any/spaces/in/it/at/all", "Reading", 0),
+			},
+			groupBy: todoist.GroupByNone,
+		},
+		{
+			// Only scripts the embedded Go font has glyphs for, like the calendar above.
+			name: "non_ascii",
+			tasks: []todoist.Task{
+				task("Crème brûlée für die Party", "Küche", 0),
+				task("Купить молоко", "Дом", 0),
+				task("Αγορά γάλακτος", "Σπίτι", 0),
+			},
+			groupBy: todoist.GroupByNone,
+		},
+		{
+			name:    "overflow_single_column",
+			tasks:   many(20),
+			groupBy: todoist.GroupByNone,
+		},
+		{
+			name:    "overflow_more",
+			tasks:   many(60),
+			groupBy: todoist.GroupByNone,
+		},
+	}
+
+	fonts, theme := testFonts(t), testTheme(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img := GenerateTodoistImage(fonts, theme, tc.tasks, tc.groupBy, goldenNow, panelWidth, panelHeight)
+			assertGolden(t, "todoist_"+tc.name, img)
+		})
+	}
+}
+
+// TestThemesGolden renders a busy dashboard in every built-in theme.
+func TestThemesGolden(t *testing.T) {
+	fonts := testFonts(t)
+	for _, name := range ThemeNames() {
+		t.Run(name, func(t *testing.T) {
+			theme, err := LoadTheme(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, "theme_"+name, busyDashboard(fonts, theme, 2*panelWidth, panelHeight))
+		})
+	}
+}
+
+func TestPalettesGolden(t *testing.T) {
+	fonts := testFonts(t)
+	for _, name := range PaletteNames() {
+		t.Run(name, func(t *testing.T) {
+			theme := testTheme(t)
+			palette, err := LoadPalette(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			theme.Palette = palette
+			assertGolden(t, "palette_"+name, Dither(busyDashboard(fonts, theme, 2*panelWidth, panelHeight), palette))
+		})
+	}
+}
+
+func TestLowBatteryGolden(t *testing.T) {
+	fonts, theme := testFonts(t), testTheme(t)
+	img := dashboardImage(fonts, theme, nil, nil, 2*panelWidth, panelHeight)
+	assertGolden(t, "low_battery", AddLowBatteryIcon(img, theme))
+}
+
+// TestDevicesGolden renders a busy dashboard laid out for the panels that are
+// smaller than the default one, or turned on their side.
+func TestDevicesGolden(t *testing.T) {
+	fonts := testFonts(t)
+	for _, name := range []string{"inky-frame-4", "kindle"} {
+		t.Run(name, func(t *testing.T) {
+			device, err := LoadDevice(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			theme := testTheme(t)
+			theme.Palette = device.Palette
+			width, height := device.Size()
+			img := busyDashboard(fonts, theme, float64(width), float64(height))
+			assertGolden(t, "device_"+name, Dither(device.Fit(img, theme.Background), device.Palette))
+		})
+	}
+}
+
+func TestNightGolden(t *testing.T) {
+	morning := time.Date(2024, time.March, 5, 7, 0, 0, 0, time.UTC)
+	first := gcalendar.Event{Title: "Standup", Start: time.Date(2024, time.March, 5, 9, 30, 0, 0, time.UTC), End: time.Date(2024, time.March, 5, 9, 45, 0, 0, time.UTC)}
+
+	forecast := weather.Forecast{Code: 61, Low: 3.6, High: 11.8, PrecipitationChance: 80}
+
+	tests := []struct {
+		name     string
+		first    *gcalendar.Event
+		forecast *weather.Forecast
+	}{
+		{name: "night", first: &first},
+		{name: "night_empty"},
+		{name: "night_weather", first: &first, forecast: &forecast},
+	}
+
+	fonts, theme := testFonts(t), testTheme(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertGolden(t, tc.name, GenerateNightImage(fonts, theme, morning, tc.first, nil, tc.forecast, 2*panelWidth, panelHeight))
+		})
+	}
+}
+
+// goldenAt returns the time of day hour:minute on the day of goldenNow.
+func goldenAt(hour, minute int) time.Time {
+	return time.Date(goldenNow.Year(), goldenNow.Month(), goldenNow.Day(), hour, minute, 0, 0, goldenNow.Location())
+}
+
+// busyDashboard renders a width x height dashboard with events and tasks in
+// every state and colour, for the tests that cover how the whole dashboard looks.
+func busyDashboard(fonts *Fonts, theme *Theme, width, height float64) image.Image {
+	events := []gcalendar.Event{
+		{Title: "Planning", Start: goldenAt(10, 0), End: goldenAt(11, 0), Location: "Room 1", ColorID: "9", ResponseStatus: gcalendar.ResponseAccepted},
+		{Title: "Interview", Start: goldenAt(10, 30), End: goldenAt(11, 30), ColorID: "11", ResponseStatus: gcalendar.ResponseTentative},
+		{Title: "Lunch", Start: goldenAt(12, 0), End: goldenAt(13, 0), ColorID: "10", ResponseStatus: gcalendar.ResponseNeedsAction},
+		{Title: "Focus", Start: goldenAt(13, 0), End: goldenAt(14, 0), ColorID: "5", ResponseStatus: gcalendar.ResponseAccepted},
+		{Title: "Gym", Start: goldenAt(14, 0), End: goldenAt(15, 0), ColorID: "8", Transparent: true, ResponseStatus: gcalendar.ResponseAccepted},
+	}
+	tasks := []todoist.Task{
+		{Content: "Write the design document", Project: "Work", ProjectColor: "blue", Due: goldenAt(9, 0)},
+		{Content: "Pay the rent", Project: "Home", ProjectColor: "red", Due: goldenAt(9, 0)},
+		{Content: "Water the plants", Project: "Garden", ProjectColor: "lime_green", Due: goldenAt(9, 0)},
+		{Content: "Buy milk", Project: "Inbox", ProjectColor: "charcoal", Due: goldenAt(18, 0)},
+	}
+	return dashboardImage(fonts, theme, tasks, events, width, height)
+}
+
+// dashboardImage renders the tasks and calendar panels side by side at
+// goldenNow, each taking half of width, like the dashboard.
+func dashboardImage(fonts *Fonts, theme *Theme, tasks []todoist.Task, events []gcalendar.Event, width, height float64) image.Image {
+	view := CalendarView{Mode: ViewRolling, Hours: 8, NowNext: true}
+	todoWidth := float64(int(width) / 2)
+	return MergeImages(
+		GenerateTodoistImage(fonts, theme, tasks, todoist.GroupByProject, goldenNow, todoWidth, height),
+		GenerateCalendarImage(fonts, theme, events, view, goldenNow, width-todoWidth, height),
+	)
+}
+
+func testTheme(t *testing.T) *Theme {
+	t.Helper()
+
+	theme, err := LoadTheme(DefaultTheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return theme
+}
+
+func testFonts(t *testing.T) *Fonts {
+	t.Helper()
+
+	fonts, err := NewFonts(nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fonts
+}
+
+// assertGolden compares img pixel by pixel against testdata/<name>.png. Run the
+// tests with -update to accept the new image. On a mismatch the rendered image
+// and a diff, with the differing pixels in red, are written to testdata/failed.
+func assertGolden(t *testing.T, name string, img image.Image) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		if err := writePNG(path, img); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unable to open golden file, run with -update to create it: %v", err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, count := diffImages(want, img)
+	if count == 0 {
+		return
+	}
+
+	failedDir := filepath.Join("testdata", "failed")
+	actualPath := filepath.Join(failedDir, name+".actual.png")
+	diffPath := filepath.Join(failedDir, name+".diff.png")
+	if err := writePNG(actualPath, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePNG(diffPath, diff); err != nil {
+		t.Fatal(err)
+	}
+	t.Errorf("%d pixels differ from %s, see %s and %s", count, path, actualPath, diffPath)
+}
+
+// diffImages returns an image highlighting the pixels that differ between a and
+// b in red on top of a faded copy of a, and the number of differing pixels.
+func diffImages(a, b image.Image) (image.Image, int) {
+	bounds := a.Bounds().Union(b.Bounds())
+	diff := image.NewRGBA(bounds)
+	if a.Bounds() != b.Bounds() {
+		draw.Draw(diff, bounds, &image.Uniform{C: color.RGBA{255, 0, 0, 255}}, image.Point{}, draw.Src)
+		return diff, bounds.Dx() * bounds.Dy()
+	}
+
+	count := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca := color.RGBAModel.Convert(a.At(x, y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(b.At(x, y)).(color.RGBA)
+			if ca != cb {
+				diff.Set(x, y, color.RGBA{255, 0, 0, 255})
+				count++
+				continue
+			}
+			gray := color.GrayModel.Convert(ca).(color.Gray)
+			faded := 255 - (255-gray.Y)/4
+			diff.Set(x, y, color.RGBA{faded, faded, faded, 255})
+		}
+	}
+	return diff, count
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
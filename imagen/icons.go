@@ -0,0 +1,84 @@
+package imagen
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+// The icons are drawn in the current colour, centred in a size x size box
+// with its top left corner at (x, y).
+
+// drawVideoIcon draws a video camera.
+func drawVideoIcon(ctx *gg.Context, x, y, size float64) {
+	bodyWidth, bodyHeight := size*0.5, size*0.4
+	top := y + (size-bodyHeight)/2
+
+	ctx.DrawRoundedRectangle(x+size*0.15, top, bodyWidth, bodyHeight, size*0.05)
+	ctx.Fill()
+
+	lensX := x + size*0.15 + bodyWidth
+	ctx.MoveTo(lensX, y+size/2)
+	ctx.LineTo(lensX+size*0.2, top)
+	ctx.LineTo(lensX+size*0.2, top+bodyHeight)
+	ctx.ClosePath()
+	ctx.Fill()
+}
+
+// drawPinIcon draws a map pin.
+func drawPinIcon(ctx *gg.Context, x, y, size float64) {
+	radius := size * 0.22
+	cx, cy := x+size/2, y+size*0.35
+
+	ctx.DrawCircle(cx, cy, radius)
+	ctx.Fill()
+	ctx.MoveTo(cx-radius, cy)
+	ctx.LineTo(cx, y+size*0.85)
+	ctx.LineTo(cx+radius, cy)
+	ctx.ClosePath()
+	ctx.Fill()
+}
+
+// drawWarningIcon draws a triangle with an exclamation mark in the background colour.
+func drawWarningIcon(ctx *gg.Context, x, y, size float64, background color.Color) {
+	ctx.MoveTo(x+size/2, y+size*0.05)
+	ctx.LineTo(x+size*0.95, y+size*0.9)
+	ctx.LineTo(x+size*0.05, y+size*0.9)
+	ctx.ClosePath()
+	ctx.Fill()
+
+	ctx.Push()
+	ctx.SetColor(background)
+	ctx.DrawRoundedRectangle(x+size*0.46, y+size*0.35, size*0.08, size*0.3, size*0.03)
+	ctx.Fill()
+	ctx.DrawCircle(x+size/2, y+size*0.76, size*0.05)
+	ctx.Fill()
+	ctx.Pop()
+}
+
+// drawLowBatteryIcon draws an empty battery lying on its side, with a sliver of charge left.
+func drawLowBatteryIcon(ctx *gg.Context, x, y, size float64) {
+	bodyWidth, bodyHeight := size*0.8, size*0.45
+	top := y + (size-bodyHeight)/2
+
+	ctx.SetLineWidth(size * 0.06)
+	ctx.DrawRoundedRectangle(x+size*0.05, top, bodyWidth, bodyHeight, size*0.06)
+	ctx.Stroke()
+	ctx.DrawRectangle(x+size*0.05+bodyWidth, top+bodyHeight*0.3, size*0.1, bodyHeight*0.4)
+	ctx.Fill()
+
+	ctx.DrawRectangle(x+size*0.13, top+size*0.08, size*0.12, bodyHeight-size*0.16)
+	ctx.Fill()
+}
+
+// drawMoonIcon draws a crescent moon, cutting it out of a full one with the background colour.
+func drawMoonIcon(ctx *gg.Context, x, y, size float64, background color.Color) {
+	ctx.DrawCircle(x+size/2, y+size/2, size*0.45)
+	ctx.Fill()
+
+	ctx.Push()
+	ctx.SetColor(background)
+	ctx.DrawCircle(x+size*0.7, y+size*0.35, size*0.38)
+	ctx.Fill()
+	ctx.Pop()
+}
@@ -0,0 +1,54 @@
+package imagen
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/fogleman/gg"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+	"github.com/gouthamve/gophercal/weather"
+)
+
+const nightIconSize = 120.0
+
+// GenerateNightImage draws the width x height screen shown during the quiet
+// hours: the day the display wakes up on, its weather forecast and its first
+// event. first is nil if there isn't one, and calendarErr is set when it
+// couldn't be looked up. forecast is nil if the weather isn't shown or
+// couldn't be fetched.
+func GenerateNightImage(fonts *Fonts, theme *Theme, morning time.Time, first *gcalendar.Event, calendarErr error, forecast *weather.Forecast, width, height float64) image.Image {
+	nightCtx := gg.NewContext(int(width), int(height))
+	nightCtx.SetColor(theme.Background)
+	nightCtx.Clear()
+
+	scale := cardScale(height)
+	iconSize := nightIconSize * scale
+
+	nightCtx.SetColor(theme.Foreground)
+	top := height / 5
+	drawMoonIcon(nightCtx, (width-iconSize)/2, top, iconSize, theme.Background)
+	top += iconSize + 50*scale
+
+	textWidth := width - 4*errorMargin*scale
+	textX := 2 * errorMargin * scale
+	top += textBlock{text: morning.Format("Monday"), style: Bold, size: 72 * scale, maxLines: 1, ax: 0.5}.draw(nightCtx, fonts, textX, top, textWidth, 0)
+	top += textBlock{text: morning.Format("January 2"), style: Regular, size: 40 * scale, maxLines: 1, ax: 0.5}.draw(nightCtx, fonts, textX, top, textWidth, 0)
+	if forecast != nil {
+		top += 20 * scale
+		top += textBlock{text: forecast.String(), style: Regular, size: 30 * scale, maxLines: 1, ax: 0.5}.draw(nightCtx, fonts, textX, top, textWidth, 0)
+	}
+	top += 50 * scale
+
+	firstUp := "Nothing on the calendar"
+	switch {
+	case calendarErr != nil:
+		firstUp = "Couldn't check the calendar"
+	case first != nil:
+		firstUp = fmt.Sprintf("First up: %s  %s", first.Start.Format("15:04"), first.Title)
+	}
+	textBlock{text: firstUp, style: Italic, size: 30 * scale, maxLines: 2, ax: 0.5}.draw(nightCtx, fonts, textX, top, textWidth, 0)
+
+	return nightCtx.Image()
+}
@@ -0,0 +1,111 @@
+package imagen
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/fogleman/gg"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+)
+
+// nowNextHeight is the height of the now/next panel when it's shown above the calendar.
+const nowNextHeight = 110.0
+
+// GenerateNowNextImage draws a width x height panel with the event that is
+// happening at now and a countdown to the next one. It's drawn inverted while
+// we're in a meeting so it stands out.
+func GenerateNowNextImage(fonts *Fonts, theme *Theme, events []gcalendar.Event, now time.Time, width, height float64) image.Image {
+	statusFace := fonts.Face(Bold, 28)
+	face := fonts.Face(Regular, 20)
+
+	current, next := nowAndNext(events, now)
+
+	nnCtx := gg.NewContext(int(width), int(height))
+	nnCtx.DrawRoundedRectangle(theme.OutsideBoundaryWidth, theme.OutsideBoundaryWidth, width-2*theme.OutsideBoundaryWidth, height-2*theme.OutsideBoundaryWidth, theme.CornerRadius)
+	if current != nil {
+		nnCtx.SetColor(theme.Foreground)
+		nnCtx.Fill()
+		nnCtx.SetColor(theme.Background)
+	} else {
+		nnCtx.SetColor(theme.Background)
+		nnCtx.FillPreserve()
+		nnCtx.SetColor(theme.Foreground)
+		nnCtx.SetLineWidth(theme.LineWidth)
+		nnCtx.Stroke()
+	}
+
+	lines := []string{}
+	switch {
+	case current != nil:
+		lines = append(lines, fmt.Sprintf("In meeting until %s", current.End.Format("15:04")), current.Title)
+	case next != nil && sameDay(next.Start, now):
+		lines = append(lines, fmt.Sprintf("Free until %s", next.Start.Format("15:04")))
+	default:
+		lines = append(lines, "Free for the rest of the day")
+	}
+	if next != nil {
+		lines = append(lines, fmt.Sprintf("Next: %s, %s", next.Title, formatCountdown(next.Start.Sub(now))))
+	} else {
+		lines = append(lines, "Nothing else coming up")
+	}
+
+	textX := 4 * theme.InnerBoundaryWidth
+	textWidth := width - 2*textX
+	lineHeight := height / float64(len(lines))
+	for i, line := range lines {
+		if i == 0 {
+			nnCtx.SetFontFace(statusFace)
+		} else {
+			nnCtx.SetFontFace(face)
+		}
+		drawText(nnCtx, truncateString(nnCtx, line, textWidth), textX, (float64(i)+0.5)*lineHeight, 0, 0.5)
+	}
+
+	return nnCtx.Image()
+}
+
+// nowAndNext returns the event that is happening at now, if any, and the next
+// one to start. When several events are happening, the latest one to start wins.
+// Events that are marked as free are ignored.
+func nowAndNext(events []gcalendar.Event, now time.Time) (*gcalendar.Event, *gcalendar.Event) {
+	var current, next *gcalendar.Event
+	for i := range events {
+		event := &events[i]
+		if event.Transparent {
+			continue
+		}
+
+		if !event.Start.After(now) && event.End.After(now) {
+			if current == nil || event.Start.After(current.Start) {
+				current = event
+			}
+			continue
+		}
+		if event.Start.After(now) && (next == nil || event.Start.Before(next.Start)) {
+			next = event
+		}
+	}
+	return current, next
+}
+
+// formatCountdown returns how long until something happens, like "in 1 h 5 min".
+func formatCountdown(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	switch {
+	case minutes < 1:
+		return "now"
+	case minutes < 60:
+		return fmt.Sprintf("in %d min", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("in %d h", minutes/60)
+	}
+	return fmt.Sprintf("in %d h %d min", minutes/60, minutes%60)
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,316 @@
+package imagen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/fogleman/gg"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+	"github.com/gouthamve/gophercal/todoist"
+)
+
+// Palette is the set of inks a display can show. Dashboards for displays with
+// a palette are dithered to it, and events and projects are marked with the
+// palette colour closest to their colour in Google Calendar and Todoist.
+type Palette struct {
+	Name string
+	// Colors are the inks of the display. Grayscale displays have none, their
+	// images are left as they are and the display's driver picks the shades.
+	Colors color.Palette
+}
+
+// GrayscalePalette is the name of the palette used when none is configured.
+const GrayscalePalette = "gray"
+
+var palettes = map[string]*Palette{
+	GrayscalePalette: {Name: GrayscalePalette},
+	"gray16":         {Name: "gray16", Colors: grayShades(16)},
+	"bw": {Name: "bw", Colors: color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 255, 255, 255},
+	}},
+	// bwr and bwy are the three colour panels, like the Inkplate 2 and the
+	// Waveshare B and C panels.
+	"bwr": {Name: "bwr", Colors: color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 255, 255, 255},
+		color.RGBA{255, 0, 0, 255},
+	}},
+	"bwy": {Name: "bwy", Colors: color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 255, 255, 255},
+		color.RGBA{255, 255, 0, 255},
+	}},
+	// 7color is the ACeP palette of the Inky Frame and the Inkplate 6COLOR.
+	"7color": {Name: "7color", Colors: color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 255, 255, 255},
+		color.RGBA{0, 255, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{255, 255, 0, 255},
+		color.RGBA{255, 128, 0, 255},
+	}},
+}
+
+// grayShades returns a palette of n evenly spaced shades from black to white.
+func grayShades(n int) color.Palette {
+	shades := make(color.Palette, n)
+	for i := range shades {
+		shades[i] = color.Gray{Y: uint8(i * 255 / (n - 1))}
+	}
+	return shades
+}
+
+// PaletteNames returns the names of the built-in palettes.
+func PaletteNames() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadPalette returns the built-in palette called name.
+func LoadPalette(name string) (*Palette, error) {
+	palette, ok := palettes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette %q, use one of %s", name, strings.Join(PaletteNames(), ", "))
+	}
+	return palette, nil
+}
+
+const (
+	// minSaturation is how colourful a colour has to be to get an ink, so
+	// greys and browns are left as they are.
+	minSaturation = 0.3
+	// maxHueDistance is how far in degrees the hue of an ink can be from a
+	// colour for it to stand in for that colour.
+	maxHueDistance = 40.0
+)
+
+// Ink returns the colourful ink of the palette with the hue closest to c. It
+// returns false when c is grey or the palette has no ink close enough to it,
+// like blue on a black, white and red display.
+func (p *Palette) Ink(c color.Color) (color.Color, bool) {
+	if p == nil {
+		return nil, false
+	}
+	hue, saturation, _ := hsv(c)
+	if saturation < minSaturation {
+		return nil, false
+	}
+
+	var (
+		best     color.Color
+		bestDist = maxHueDistance
+	)
+	for _, ink := range p.Colors {
+		inkHue, inkSaturation, _ := hsv(ink)
+		if inkSaturation < minSaturation {
+			continue
+		}
+		dist := math.Abs(hue - inkHue)
+		if dist > 180 {
+			dist = 360 - dist
+		}
+		if dist <= bestDist {
+			best, bestDist = ink, dist
+		}
+	}
+	return best, best != nil
+}
+
+// Dither returns img drawn with only the inks of the palette, using
+// Floyd-Steinberg error diffusion for everything in between. Greys are only
+// dithered with the black, white and grey inks, so grey fills don't get
+// speckled with colour. Images for palettes without inks are returned as
+// they are.
+func Dither(img image.Image, p *Palette) image.Image {
+	if p == nil || len(p.Colors) == 0 {
+		return img
+	}
+
+	var grays color.Palette
+	for _, ink := range p.Colors {
+		if _, s, _ := hsv(ink); s < minSaturation {
+			grays = append(grays, ink)
+		}
+	}
+	if len(grays) == 0 {
+		grays = p.Colors
+	}
+
+	bounds := img.Bounds()
+	dithered := image.NewPaletted(bounds, p.Colors)
+	width := bounds.Dx()
+	// The error carried to this row and the next one, with a pixel of padding on either side.
+	errs := [2][][3]float64{make([][3]float64, width+2), make([][3]float64, width+2)}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := x - bounds.Min.X + 1
+			c := img.At(x, y)
+			r, g, b, _ := c.RGBA()
+			want := [3]float64{
+				float64(r>>8) + errs[0][i][0],
+				float64(g>>8) + errs[0][i][1],
+				float64(b>>8) + errs[0][i][2],
+			}
+
+			inks := p.Colors
+			if _, s, _ := hsv(c); s < minSaturation {
+				inks = grays
+			}
+			ink := inks.Convert(color.RGBA{clampUint8(want[0]), clampUint8(want[1]), clampUint8(want[2]), 255})
+			dithered.Set(x, y, ink)
+
+			ir, ig, ib, _ := ink.RGBA()
+			got := [3]float64{float64(ir >> 8), float64(ig >> 8), float64(ib >> 8)}
+			for k := range want {
+				e := want[k] - got[k]
+				errs[0][i+1][k] += e * 7 / 16
+				errs[1][i-1][k] += e * 3 / 16
+				errs[1][i][k] += e * 5 / 16
+				errs[1][i+1][k] += e * 1 / 16
+			}
+		}
+		errs[0], errs[1] = errs[1], make([][3]float64, width+2)
+	}
+	return dithered
+}
+
+// Quantize returns img in grey, rounded to the 1<<bitDepth evenly spaced
+// shades a panel with bitDepth bits per pixel shows. Images are returned as
+// they are for bit depths of 0, or of 8 and more.
+func Quantize(img image.Image, bitDepth int) image.Image {
+	if bitDepth <= 0 || bitDepth >= 8 {
+		return img
+	}
+
+	shades := grayShades(1 << bitDepth)
+	bounds := img.Bounds()
+	quantized := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			quantized.Set(x, y, shades.Convert(img.At(x, y)))
+		}
+	}
+	return quantized
+}
+
+func clampUint8(v float64) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// hsv returns the hue in degrees, and the saturation and value between 0 and 1 of c.
+func hsv(c color.Color) (h, s, v float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r, g, b := float64(n.R)/255, float64(n.G)/255, float64(n.B)/255
+
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	v = max
+	if max == 0 || max == min {
+		return 0, 0, v
+	}
+	s = (max - min) / max
+
+	switch max {
+	case r:
+		h = 60 * (g - b) / (max - min)
+	case g:
+		h = 60 * (2 + (b-r)/(max-min))
+	default:
+		h = 60 * (4 + (r-g)/(max-min))
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// googleEventColors are the event colours of Google Calendar, by colorId.
+var googleEventColors = map[string]color.RGBA{
+	"1":  {121, 134, 203, 255}, // Lavender
+	"2":  {51, 182, 121, 255},  // Sage
+	"3":  {142, 36, 170, 255},  // Grape
+	"4":  {230, 124, 115, 255}, // Flamingo
+	"5":  {246, 191, 38, 255},  // Banana
+	"6":  {244, 81, 30, 255},   // Tangerine
+	"7":  {3, 155, 229, 255},   // Peacock
+	"8":  {97, 97, 97, 255},    // Graphite
+	"9":  {63, 81, 181, 255},   // Blueberry
+	"10": {11, 128, 67, 255},   // Basil
+	"11": {213, 0, 0, 255},     // Tomato
+}
+
+// todoistColors are the project colours of Todoist, by name.
+var todoistColors = map[string]color.RGBA{
+	"berry_red":   {184, 37, 111, 255},
+	"red":         {219, 64, 53, 255},
+	"orange":      {255, 153, 51, 255},
+	"yellow":      {250, 208, 0, 255},
+	"olive_green": {175, 184, 59, 255},
+	"lime_green":  {126, 204, 73, 255},
+	"green":       {41, 148, 56, 255},
+	"mint_green":  {106, 204, 188, 255},
+	"teal":        {21, 143, 173, 255},
+	"sky_blue":    {20, 170, 245, 255},
+	"light_blue":  {150, 195, 235, 255},
+	"blue":        {64, 115, 255, 255},
+	"grape":       {136, 77, 255, 255},
+	"violet":      {175, 56, 235, 255},
+	"lavender":    {235, 150, 235, 255},
+	"magenta":     {224, 81, 148, 255},
+	"salmon":      {255, 141, 133, 255},
+	"charcoal":    {128, 128, 128, 255},
+	"grey":        {184, 184, 184, 255},
+	"taupe":       {204, 172, 147, 255},
+}
+
+// colorStripeWidth is the width of the stripe that marks coloured events.
+const colorStripeWidth = 8.0
+
+// drawColorStripe fills a stripe of ink from stripeX across the rounded box at (x, y).
+func drawColorStripe(ctx *gg.Context, ink color.Color, stripeX, x, y, width, height, radius float64) {
+	ctx.Push()
+	defer ctx.Pop()
+
+	ctx.DrawRoundedRectangle(x, y, width, height, radius)
+	ctx.Clip()
+	ctx.DrawRectangle(stripeX, y, colorStripeWidth, height)
+	ctx.SetColor(ink)
+	ctx.Fill()
+}
+
+// eventInk returns the ink that marks the event, if it has a colour of its own
+// and the palette has an ink for it.
+func eventInk(theme *Theme, event gcalendar.Event) (color.Color, bool) {
+	c, ok := googleEventColors[event.ColorID]
+	if !ok {
+		return nil, false
+	}
+	return theme.Palette.Ink(c)
+}
+
+// projectInk returns the ink that marks the project of the task, if the
+// palette has one for its colour.
+func projectInk(theme *Theme, task todoist.Task) (color.Color, bool) {
+	c, ok := todoistColors[task.ProjectColor]
+	if !ok {
+		return nil, false
+	}
+	return theme.Palette.Ink(c)
+}
@@ -0,0 +1,86 @@
+package imagen
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestPaletteInk(t *testing.T) {
+	var (
+		red    = color.RGBA{255, 0, 0, 255}
+		green  = color.RGBA{0, 255, 0, 255}
+		blue   = color.RGBA{0, 0, 255, 255}
+		yellow = color.RGBA{255, 255, 0, 255}
+	)
+
+	tests := []struct {
+		palette string
+		in      color.Color
+		want    color.Color
+	}{
+		{palette: "7color", in: googleEventColors["1"], want: blue},
+		{palette: "7color", in: googleEventColors["2"], want: green},
+		{palette: "7color", in: googleEventColors["11"], want: red},
+		{palette: "7color", in: todoistColors["yellow"], want: yellow},
+		{palette: "7color", in: googleEventColors["8"]},
+		{palette: "7color", in: todoistColors["taupe"]},
+		{palette: "bwr", in: googleEventColors["4"], want: red},
+		{palette: "bwr", in: googleEventColors["9"]},
+		{palette: "bw", in: googleEventColors["11"]},
+		{palette: GrayscalePalette, in: googleEventColors["11"]},
+	}
+
+	for _, tc := range tests {
+		palette, err := LoadPalette(tc.palette)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := palette.Ink(tc.in)
+		if ok != (tc.want != nil) || (ok && got != tc.want) {
+			t.Errorf("%s: ink for %v is %v, %v, want %v", tc.palette, tc.in, got, ok, tc.want)
+		}
+	}
+}
+
+func TestDitherUsesPalette(t *testing.T) {
+	palette, err := LoadPalette("bwr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := Dither(GenerateErrorImage(testFonts(t), testTheme(t), "Title", "Hint", "Details", 2*panelWidth, panelHeight), palette)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y))
+			if palette.Colors.Convert(c) != c {
+				t.Fatalf("pixel at %d,%d is %v, which isn't in the palette", x, y, c)
+			}
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := GenerateErrorImage(testFonts(t), testTheme(t), "Title", "Hint", "Details", 2*panelWidth, panelHeight)
+
+	shades := make(map[uint8]bool)
+	quantized := Quantize(img, 3)
+	bounds := quantized.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			shades[color.GrayModel.Convert(quantized.At(x, y)).(color.Gray).Y] = true
+		}
+	}
+	if len(shades) > 8 {
+		t.Errorf("got %d shades, want at most 8", len(shades))
+	}
+	for shade := range shades {
+		if grayShades(8).Convert(color.Gray{Y: shade}) != (color.Gray{Y: shade}) {
+			t.Errorf("shade %d isn't one of the 8 evenly spaced shades", shade)
+		}
+	}
+
+	if Quantize(img, 0) != img {
+		t.Error("images shouldn't be changed for a bit depth of 0")
+	}
+}
@@ -0,0 +1,247 @@
+package imagen
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/bidi"
+)
+
+const (
+	tatweel = '\u0640'
+	lam     = '\u0644'
+)
+
+// drawText draws s like gg's DrawStringAnchored, after laying it out with
+// displayText, so right-to-left and Arabic text come out readable.
+func drawText(ctx *gg.Context, s string, x, y, ax, ay float64) {
+	ctx.DrawStringAnchored(displayText(s), x, y, ax, ay)
+}
+
+// measureText returns the width of s as drawText draws it.
+func measureText(ctx *gg.Context, s string) float64 {
+	w, _ := ctx.MeasureString(shapeArabic(s))
+	return w
+}
+
+// truncateString shortens str so it fits in maxWidth, ending it with "...".
+// It only cuts between graphemes, so accented letters and emoji stay whole.
+func truncateString(ctx *gg.Context, str string, maxWidth float64) string {
+	if measureText(ctx, str) <= maxWidth {
+		return str
+	}
+
+	clusters := graphemes(str)
+	for i := len(clusters) - 1; i >= 0; i-- {
+		truncatedString := strings.Join(clusters[:i], "") + "..."
+		if measureText(ctx, truncatedString) <= maxWidth {
+			return truncatedString
+		}
+	}
+
+	return ""
+}
+
+// graphemes splits s into what readers see as single characters, following the
+// Unicode grapheme cluster rules: a letter with its combining marks, a Hangul
+// syllable made of jamo, an emoji with its modifiers or a flag.
+func graphemes(s string) []string {
+	var clusters []string
+	state := -1
+	for len(s) > 0 {
+		var cluster string
+		cluster, s, _, state = uniseg.FirstGraphemeClusterInString(s, state)
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// displayText returns s in the order its characters are drawn from left to
+// right. Arabic letters are joined, and the runs of right-to-left text are
+// reordered following the Unicode bidi algorithm.
+func displayText(s string) string {
+	s = shapeArabic(s)
+	if strings.IndexFunc(s, isRightToLeft) < 0 {
+		return s
+	}
+
+	var p bidi.Paragraph
+	if _, err := p.SetString(s); err != nil {
+		return s
+	}
+	order, err := p.Order()
+	if err != nil {
+		return s
+	}
+
+	// The runs come back in logical order, give them their embedding levels
+	// and reorder them with rule L2.
+	rtl := isRightToLeftParagraph(s)
+	type run struct {
+		text  string
+		level int
+	}
+	runs := make([]run, order.NumRuns())
+	maxLevel := 0
+	for i := range runs {
+		r := order.Run(i)
+		level := 0
+		switch {
+		case r.Direction() == bidi.RightToLeft:
+			level = 1
+		case rtl:
+			level = 2
+		case i > 0 && runs[i-1].level == 1 && !hasLeftToRight(r.String()):
+			// Numbers after right-to-left text are part of it.
+			level = 2
+		}
+		runs[i] = run{text: r.String(), level: level}
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	for level := maxLevel; level > 0; level-- {
+		for i := 0; i < len(runs); {
+			if runs[i].level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(runs) && runs[j].level >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				runs[a], runs[b] = runs[b], runs[a]
+			}
+			i = j
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range runs {
+		if r.level%2 == 0 {
+			b.WriteString(r.text)
+			continue
+		}
+		clusters := graphemes(r.text)
+		for i := len(clusters) - 1; i >= 0; i-- {
+			// ReverseString mirrors brackets, and leaves longer graphemes alone.
+			if len([]rune(clusters[i])) == 1 {
+				b.WriteString(bidi.ReverseString(clusters[i]))
+			} else {
+				b.WriteString(clusters[i])
+			}
+		}
+	}
+	return b.String()
+}
+
+func isRightToLeft(r rune) bool {
+	props, _ := bidi.LookupRune(r)
+	return props.Class() == bidi.R || props.Class() == bidi.AL
+}
+
+func hasLeftToRight(s string) bool {
+	for _, r := range s {
+		if props, _ := bidi.LookupRune(r); props.Class() == bidi.L {
+			return true
+		}
+	}
+	return false
+}
+
+// isRightToLeftParagraph returns whether the first letter with a direction in
+// s is right-to-left, which makes the whole text right-to-left.
+func isRightToLeftParagraph(s string) bool {
+	for _, r := range s {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// shapeArabic replaces Arabic letters with the presentation forms for their
+// position in the word, and lam followed by alef with their ligature.
+func shapeArabic(s string) string {
+	if strings.IndexFunc(s, func(r rune) bool { _, ok := arabicForms[r]; return ok }) < 0 {
+		return s
+	}
+
+	runes := []rune(s)
+	shaped := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			shaped = append(shaped, r)
+			continue
+		}
+		joinsPrev := arabicJoinsPrev(runes, i)
+
+		if r == lam && i+1 < len(runes) {
+			if ligature, ok := lamAlefForms[runes[i+1]]; ok {
+				if joinsPrev {
+					shaped = append(shaped, ligature[1])
+				} else {
+					shaped = append(shaped, ligature[0])
+				}
+				i++
+				continue
+			}
+		}
+
+		dual := forms[initialForm] != 0
+		joinsNext := dual && arabicJoinsNext(runes, i)
+		form := isolatedForm
+		switch {
+		case joinsPrev && joinsNext:
+			form = medialForm
+		case joinsPrev && forms[finalForm] != 0:
+			form = finalForm
+		case joinsNext:
+			form = initialForm
+		}
+		shaped = append(shaped, forms[form])
+	}
+	return string(shaped)
+}
+
+// arabicJoinsPrev returns whether the letter before runes[i], skipping marks,
+// connects to it.
+func arabicJoinsPrev(runes []rune, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		if unicode.Is(unicode.Mn, runes[j]) {
+			continue
+		}
+		if runes[j] == tatweel {
+			return true
+		}
+		forms, ok := arabicForms[runes[j]]
+		return ok && forms[initialForm] != 0
+	}
+	return false
+}
+
+// arabicJoinsNext returns whether there's a letter after runes[i], skipping
+// marks, that it can connect to.
+func arabicJoinsNext(runes []rune, i int) bool {
+	for j := i + 1; j < len(runes); j++ {
+		if unicode.Is(unicode.Mn, runes[j]) {
+			continue
+		}
+		if runes[j] == tatweel {
+			return true
+		}
+		_, ok := arabicForms[runes[j]]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package imagen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/fogleman/gg"
+)
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{name: "ascii", in: "abc", want: []string{"a", "b", "c"}},
+		{name: "combining accent", in: "éx", want: []string{"é", "x"}},
+		{name: "skin tone", in: "👍🏽!", want: []string{"👍🏽", "!"}},
+		{name: "zero width joiner", in: "👩‍💻 ok", want: []string{"👩‍💻", " ", "o", "k"}},
+		{name: "flags", in: "🇩🇪🇫🇷", want: []string{"🇩🇪", "🇫🇷"}},
+		{name: "hebrew points", in: "שָׁלוֹם", want: []string{"שָׁ", "ל", "וֹ", "ם"}},
+		{name: "hangul jamo", in: "\u1112\u1161\u11ab\u1100\u1173\u11af", want: []string{"\u1112\u1161\u11ab", "\u1100\u1173\u11af"}},
+		{name: "devanagari vowel signs", in: "नमस्ते", want: []string{"न", "म", "स्", "ते"}},
+		{name: "crlf", in: "a\r\nb", want: []string{"a", "\r\n", "b"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := graphemes(tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDisplayText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "left to right", in: "Standup", want: "Standup"},
+		{name: "hebrew", in: "שלום", want: "םולש"},
+		{name: "hebrew in english", in: "Meeting פגישה 2", want: "Meeting 2 השיגפ"},
+		{name: "english in hebrew", in: "פגישה Zoom", want: "Zoom השיגפ"},
+		{name: "number in hebrew", in: "פגישה 10:00", want: "10:00 השיגפ"},
+		{name: "brackets are mirrored", in: "פגישה (צוות)", want: "(תווצ) השיגפ"},
+		{name: "points stay on their letter", in: "שָׁלוֹם", want: "םוֹלשָׁ"},
+		{name: "arabic is joined", in: "من", want: "\ufee6\ufee3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := displayText(tc.in); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "isolated letter", in: "ب", want: "\ufe8f"},
+		{name: "initial, medial and final", in: "بيت", want: "\ufe91\ufef4\ufe96"},
+		{name: "letters that don't join the next one", in: "دار", want: "\ufea9\ufe8d\ufead"},
+		{name: "lam alef ligature", in: "سلام", want: "\ufeb3\ufefc\ufee1"},
+		{name: "words are shaped separately", in: "من من", want: "\ufee3\ufee6 \ufee3\ufee6"},
+		{name: "marks don't break joins", in: "بَيت", want: "\ufe91\u064e\ufef4\ufe96"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shapeArabic(tc.in); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTruncateStringKeepsGraphemes(t *testing.T) {
+	ctx := gg.NewContext(1, 1)
+	ctx.SetFontFace(testFonts(t).Face(Regular, 20))
+
+	for _, str := range []string{"Crème brûlée für die Party", "Встреча команды", "Café 👩‍💻 🇩🇪"} {
+		for width := 0.0; width < 300; width += 5 {
+			got := truncateString(ctx, str, width)
+			if got == str || got == "" {
+				continue
+			}
+			if !utf8.ValidString(got) {
+				t.Fatalf("truncating %q to %v: got invalid UTF-8 %q", str, width, got)
+			}
+			prefix := strings.TrimSuffix(got, "...")
+			if strings.Join(graphemes(str)[:len(graphemes(prefix))], "") != prefix {
+				t.Fatalf("truncating %q to %v: got %q, which splits a grapheme", str, width, got)
+			}
+		}
+	}
+}
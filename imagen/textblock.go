@@ -0,0 +1,154 @@
+package imagen
+
+import (
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// lineSpacing is the height of a line of text relative to the font size.
+const lineSpacing = 1.25
+
+// textBlock is a paragraph of text drawn in a box. It's wrapped by words, and
+// words that are too long for a line, like URLs, are broken without a hyphen.
+// If the text doesn't fit, the font shrinks down to minSize and then the last
+// line is cut short with "...".
+type textBlock struct {
+	text  string
+	style Style
+	// size is the font size used when the text fits, minSize the smallest one
+	// it shrinks to. minSize defaults to size.
+	size, minSize float64
+	// maxLines limits the number of lines, 0 fits as many as the box can take.
+	maxLines int
+	// ax and ay align the text in the box: 0 is left or top, 0.5 the centre
+	// and 1 right or bottom.
+	ax, ay float64
+}
+
+// layout picks the font size and breaks the text into lines that fit in a
+// width x height box. A height of 0 doesn't limit the number of lines. At least
+// one line is returned for non-empty text, even if the box is too short for it.
+func (b textBlock) layout(ctx *gg.Context, fonts *Fonts, width, height float64) (lines []string, size float64) {
+	if strings.TrimSpace(b.text) == "" {
+		return nil, b.size
+	}
+	minSize := b.minSize
+	if minSize <= 0 || minSize > b.size {
+		minSize = b.size
+	}
+
+	for size = b.size; ; size-- {
+		if size < minSize {
+			size = minSize
+		}
+		ctx.SetFontFace(fonts.Face(b.style, size))
+
+		maxLines := b.maxLines
+		if height > 0 {
+			fit := int(height / (size * lineSpacing))
+			if fit < 1 {
+				fit = 1
+			}
+			if maxLines == 0 || fit < maxLines {
+				maxLines = fit
+			}
+		}
+		lines = wrapText(ctx, b.text, width)
+		fits := (maxLines == 0 || len(lines) <= maxLines) && (height == 0 || float64(len(lines))*size*lineSpacing <= height)
+		if fits || size == minSize {
+			return limitLines(ctx, lines, width, maxLines), size
+		}
+	}
+}
+
+// draw draws the block in the box with its top left corner at (x, y) and returns
+// the height of the lines drawn. It leaves the font face of ctx set to the size
+// the text was drawn in.
+func (b textBlock) draw(ctx *gg.Context, fonts *Fonts, x, y, width, height float64) float64 {
+	lines, size := b.layout(ctx, fonts, width, height)
+	lineHeight := size * lineSpacing
+	used := float64(len(lines)) * lineHeight
+	if height > used {
+		y += b.ay * (height - used)
+	}
+
+	for i, line := range lines {
+		drawText(ctx, line, x+b.ax*width, y+(float64(i)+0.5)*lineHeight, b.ax, 0.5)
+	}
+	return used
+}
+
+// wrapText breaks str into lines that fit in maxWidth. Lines are broken between
+// words where possible, and at the newlines in str.
+func wrapText(ctx *gg.Context, str string, maxWidth float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(str, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if measureText(ctx, candidate) <= maxWidth {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// A word that doesn't fit on a line of its own is broken up.
+			pieces := breakWord(ctx, word, maxWidth)
+			lines = append(lines, pieces[:len(pieces)-1]...)
+			line = pieces[len(pieces)-1]
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// breakWord splits word into pieces that fit in maxWidth. It prefers breaking
+// after punctuation, so URLs and paths break between their parts.
+func breakWord(ctx *gg.Context, word string, maxWidth float64) []string {
+	var pieces []string
+	clusters := graphemes(word)
+	for len(clusters) > 0 {
+		// Find the most graphemes that fit, always taking at least one.
+		n := 1
+		for n < len(clusters) && measureText(ctx, strings.Join(clusters[:n+1], "")) <= maxWidth {
+			n++
+		}
+		if n < len(clusters) {
+			for i := n; i > n/2; i-- {
+				if strings.ContainsAny(clusters[i-1], "/-_.?&=#:,") {
+					n = i
+					break
+				}
+			}
+		}
+
+		pieces = append(pieces, strings.Join(clusters[:n], ""))
+		clusters = clusters[n:]
+	}
+	return pieces
+}
+
+// limitLines keeps the first maxLines lines, ending the last one with "..." if
+// any were dropped. 0 keeps all of them.
+func limitLines(ctx *gg.Context, lines []string, maxWidth float64, maxLines int) []string {
+	if maxLines == 0 || len(lines) <= maxLines {
+		return lines
+	}
+
+	last := strings.Join(lines[maxLines-1:], " ")
+	lines = lines[:maxLines]
+	if measureText(ctx, last+"...") <= maxWidth {
+		lines[maxLines-1] = last + "..."
+	} else {
+		lines[maxLines-1] = truncateString(ctx, last, maxWidth)
+	}
+	return lines
+}
@@ -0,0 +1,107 @@
+package imagen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestTextBlockLayout(t *testing.T) {
+	fonts := testFonts(t)
+	ctx := gg.NewContext(1, 1)
+
+	tests := []struct {
+		name          string
+		block         textBlock
+		width, height float64
+		wantLines     int
+		wantSize      float64
+		wantEllipsis  bool
+	}{
+		{
+			name:      "short text stays on one line",
+			block:     textBlock{text: "Standup", size: 20},
+			width:     300,
+			wantLines: 1,
+			wantSize:  20,
+		},
+		{
+			name:      "wraps by words",
+			block:     textBlock{text: "Quarterly business review with the platform team", size: 20},
+			width:     200,
+			wantLines: 3,
+			wantSize:  20,
+		},
+		{
+			name:      "breaks long words",
+			block:     textBlock{text: "https://example.com/a/very/long/link/that/does/not/have/any/spaces", size: 20},
+			width:     200,
+			wantLines: 4,
+			wantSize:  20,
+		},
+		{
+			name:         "max lines ends with an ellipsis",
+			block:        textBlock{text: "Quarterly business review with the platform team", size: 20, maxLines: 2},
+			width:        200,
+			wantLines:    2,
+			wantSize:     20,
+			wantEllipsis: true,
+		},
+		{
+			name:      "shrinks to fit the box",
+			block:     textBlock{text: "Quarterly business review", size: 20, minSize: 10},
+			width:     200,
+			height:    25,
+			wantLines: 1,
+			wantSize:  17,
+		},
+		{
+			name:         "stops shrinking at the minimum size",
+			block:        textBlock{text: "Quarterly business review with the platform team", size: 20, minSize: 16},
+			width:        200,
+			height:       25,
+			wantLines:    1,
+			wantSize:     16,
+			wantEllipsis: true,
+		},
+		{
+			name:     "empty text",
+			block:    textBlock{text: " ", size: 20},
+			width:    200,
+			wantSize: 20,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lines, size := tc.block.layout(ctx, fonts, tc.width, tc.height)
+			if len(lines) != tc.wantLines || size != tc.wantSize {
+				t.Fatalf("got %d lines at size %v, want %d at size %v: %q", len(lines), size, tc.wantLines, tc.wantSize, lines)
+			}
+			for _, line := range lines {
+				if w := measureText(ctx, line); w > tc.width {
+					t.Errorf("line %q is %v wide, more than %v", line, w, tc.width)
+				}
+			}
+			if len(lines) > 0 && strings.HasSuffix(lines[len(lines)-1], "...") != tc.wantEllipsis {
+				t.Errorf("last line %q, want ellipsis %v", lines[len(lines)-1], tc.wantEllipsis)
+			}
+		})
+	}
+}
+
+func TestBreakWordPrefersPunctuation(t *testing.T) {
+	ctx := gg.NewContext(1, 1)
+	ctx.SetFontFace(testFonts(t).Face(Regular, 20))
+
+	pieces := breakWord(ctx, "https://example.com/a/very/long/link", 150)
+	if strings.Join(pieces, "") != "https://example.com/a/very/long/link" {
+		t.Fatalf("pieces %q don't add up to the word", pieces)
+	}
+	for _, piece := range pieces[:len(pieces)-1] {
+		if !strings.HasSuffix(piece, "/") && !strings.HasSuffix(piece, ".") {
+			t.Errorf("piece %q isn't broken after punctuation", piece)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package imagen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Theme is how the dashboard is drawn: its colours, line widths and proportions.
+type Theme struct {
+	// Background is the colour of the panels, Foreground the colour of text and lines.
+	Background Color `json:"background"`
+	Foreground Color `json:"foreground"`
+	// HeaderFill fills the task group and agenda day headers.
+	HeaderFill Color `json:"header_fill"`
+	// EventFill fills the events we're going to, LightEventFill the optional and free ones.
+	EventFill      Color `json:"event_fill"`
+	LightEventFill Color `json:"light_event_fill"`
+
+	LineWidth            float64 `json:"line_width"`
+	OutsideBoundaryWidth float64 `json:"outside_boundary_width"`
+	InnerBoundaryWidth   float64 `json:"inner_boundary_width"`
+	CornerRadius         float64 `json:"corner_radius"`
+
+	// TaskPortion is the part of a task row taken by its name, the project gets the rest.
+	TaskPortion float64 `json:"task_portion"`
+
+	// Palette is the palette of the display. It's set for the display rather
+	// than in theme files, and is nil for grayscale displays.
+	Palette *Palette `json:"-"`
+}
+
+// DefaultTheme is the name of the theme used when none is configured.
+const DefaultTheme = "default"
+
+var themes = map[string]Theme{
+	DefaultTheme: {
+		Background:     rgba(255, 255, 255, 255),
+		Foreground:     rgba(0, 0, 0, 255),
+		HeaderFill:     rgba(200, 200, 200, 255),
+		EventFill:      rgba(0, 0, 0, 60),
+		LightEventFill: rgba(0, 0, 0, 25),
+
+		LineWidth:            2,
+		OutsideBoundaryWidth: 2,
+		InnerBoundaryWidth:   3,
+		CornerRadius:         5,
+		TaskPortion:          0.7,
+	},
+	// high-contrast avoids light greys, which some e-paper panels wash out.
+	"high-contrast": {
+		Background:     rgba(255, 255, 255, 255),
+		Foreground:     rgba(0, 0, 0, 255),
+		HeaderFill:     rgba(150, 150, 150, 255),
+		EventFill:      rgba(0, 0, 0, 110),
+		LightEventFill: rgba(0, 0, 0, 50),
+
+		LineWidth:            3,
+		OutsideBoundaryWidth: 2,
+		InnerBoundaryWidth:   4,
+		CornerRadius:         3,
+		TaskPortion:          0.7,
+	},
+	"minimal": {
+		Background:     rgba(255, 255, 255, 255),
+		Foreground:     rgba(0, 0, 0, 255),
+		HeaderFill:     rgba(235, 235, 235, 255),
+		EventFill:      rgba(0, 0, 0, 35),
+		LightEventFill: rgba(0, 0, 0, 12),
+
+		LineWidth:            1,
+		OutsideBoundaryWidth: 1,
+		InnerBoundaryWidth:   4,
+		CornerRadius:         0,
+		TaskPortion:          0.75,
+	},
+	"dark": {
+		Background:     rgba(0, 0, 0, 255),
+		Foreground:     rgba(255, 255, 255, 255),
+		HeaderFill:     rgba(80, 80, 80, 255),
+		EventFill:      rgba(255, 255, 255, 70),
+		LightEventFill: rgba(255, 255, 255, 30),
+
+		LineWidth:            2,
+		OutsideBoundaryWidth: 2,
+		InnerBoundaryWidth:   3,
+		CornerRadius:         5,
+		TaskPortion:          0.7,
+	},
+}
+
+// ThemeNames returns the names of the built-in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme returns the built-in theme called name, or loads a theme from the
+// JSON file at name. Theme files start from the built-in theme in their "base"
+// field, or the default one, and override the fields they set:
+//
+//	{"base": "minimal", "event_fill": "#00000040", "corner_radius": 8}
+func LoadTheme(name string) (*Theme, error) {
+	if theme, ok := themes[name]; ok {
+		return &theme, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown theme %q, use one of %s or a theme file: %w", name, strings.Join(ThemeNames(), ", "), err)
+	}
+
+	var base struct {
+		Base string `json:"base"`
+	}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("unable to parse theme %s: %w", name, err)
+	}
+	if base.Base == "" {
+		base.Base = DefaultTheme
+	}
+	theme, ok := themes[base.Base]
+	if !ok {
+		return nil, fmt.Errorf("unknown base theme %q in %s", base.Base, name)
+	}
+
+	file := struct {
+		Base string `json:"base"`
+		*Theme
+	}{Theme: &theme}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("unable to parse theme %s: %w", name, err)
+	}
+
+	if theme.LineWidth < 0 || theme.OutsideBoundaryWidth < 0 || theme.InnerBoundaryWidth < 0 || theme.CornerRadius < 0 {
+		return nil, fmt.Errorf("invalid theme %s: widths and radii can't be negative", name)
+	}
+	if theme.TaskPortion <= 0 || theme.TaskPortion >= 1 {
+		return nil, fmt.Errorf("invalid theme %s: task_portion must be between 0 and 1", name)
+	}
+	return &theme, nil
+}
+
+// Color is a colour that is written as "#rrggbb" or "#rrggbbaa" in theme files.
+type Color color.RGBA
+
+// rgba returns the colour with the given non-premultiplied components.
+func rgba(r, g, b, a uint8) Color {
+	return Color(color.RGBAModel.Convert(color.NRGBA{R: r, G: g, B: b, A: a}).(color.RGBA))
+}
+
+func (c Color) RGBA() (r, g, b, a uint32) {
+	return color.RGBA(c).RGBA()
+}
+
+func (c Color) MarshalText() ([]byte, error) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 255 {
+		return []byte(fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)), nil
+	}
+	return []byte(fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)), nil
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	var r, g, b, a uint8 = 0, 0, 0, 255
+	var err error
+	s := string(text)
+	switch len(s) {
+	case 7:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b)
+	case 9:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x%02x", &r, &g, &b, &a)
+	default:
+		err = fmt.Errorf("wrong length")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid colour %q, use #rrggbb or #rrggbbaa: %w", s, err)
+	}
+
+	*c = rgba(r, g, b, a)
+	return nil
+}
@@ -3,94 +3,303 @@ package imagen
 import (
 	"fmt"
 	"image"
-	"log"
+	"time"
 
 	"github.com/fogleman/gg"
-	"github.com/golang/freetype/truetype"
-	"golang.org/x/image/font/gofont/goregular"
 
 	"github.com/gouthamve/gophercal/todoist"
 )
 
-// The inkplate is 1200x825. 50% of it would be todoist, hence 600x825
-// 75% for task name. 25% for the project
 const (
-	maxTasks             = 15
-	todoWidth            = 600.0
-	todoHeight           = 825.0
-	outsideBoundaryWidth = 2.0
-	innerBoundaryWidth   = 3.0
-	lineWidth            = 2.0
-
-	taskPortion    = 0.70
-	projectPortion = 0.30
+	// fullTaskHeight is the height of the task rows when they all fit.
+	fullTaskHeight = 55.0
+	subtaskIndent  = 20.0
+
+	// When there are more rows than fit at fullTaskHeight, they shrink down
+	// to minTaskHeight and then flow into up to maxTaskColumns columns.
+	minTaskHeight   = 37.5
+	maxTaskColumns  = 2
+	taskFontSize    = 20.0
+	minTaskFontSize = 14.0
 )
 
-func GenerateTodoistImage(tasks []todoist.Task) image.Image {
-	font, err := truetype.Parse(goregular.TTF)
-	if err != nil {
-		log.Fatal(err)
-	}
-	face := truetype.NewFace(font, &truetype.Options{Size: 20})
+// taskRow is a single line in the tasks panel. A row with collapsed > 0 stands
+// in for that many subtasks that didn't fit, a row with a header starts a group
+// and a row with more > 0 is the last row, counting the tasks that didn't fit.
+type taskRow struct {
+	task      todoist.Task
+	depth     int
+	collapsed int
+	header    string
+	more      int
+}
 
-	if len(tasks) > maxTasks {
-		tasks = tasks[:maxTasks]
-	}
+// GenerateTodoistImage draws the width x height tasks panel. now is only used
+// to group tasks by due date.
+func GenerateTodoistImage(fonts *Fonts, theme *Theme, tasks []todoist.Task, groupBy todoist.GroupBy, now time.Time, width, height float64) image.Image {
+	todoWidth, todoHeight := width, height
+	groups := todoist.GroupTasks(tasks, groupBy, now)
+	columns, rowsPerColumn := taskGrid(countTaskRows(groups), todoHeight)
+	rows := layoutTasks(groups, columns*rowsPerColumn)
 
-	tdCtx := gg.NewContext(todoWidth, todoHeight)
-	tdCtx.SetFontFace(face)
+	taskHeight := todoHeight / float64(rowsPerColumn)
+	fontSize := taskFontSize * taskHeight / fullTaskHeight
+	if fontSize > taskFontSize {
+		fontSize = taskFontSize
+	}
+	if fontSize < minTaskFontSize {
+		fontSize = minTaskFontSize
+	}
+	tdCtx := gg.NewContext(int(todoWidth), int(todoHeight))
 
 	// White background
 	tdCtx.DrawRectangle(0, 0, todoWidth, todoHeight)
-	tdCtx.SetRGB(1, 1, 1)
+	tdCtx.SetColor(theme.Background)
 	tdCtx.Fill()
 
-	tdCtx.SetRGB(0, 0, 0)
-	taskHeight := todoHeight / maxTasks
-	for i, task := range tasks {
-		// Draw a rectangle
-		yStart := float64(i) * todoHeight / maxTasks
-		rectangleWidth := todoWidth - 2*outsideBoundaryWidth
+	tdCtx.SetColor(theme.Foreground)
+	columnWidth := todoWidth / float64(columns)
+	for i, row := range rows {
+		xStart := float64(i/rowsPerColumn) * columnWidth
+		yStart := float64(i%rowsPerColumn) * taskHeight
+		drawTaskRow(tdCtx, fonts, theme, fontSize, row, xStart, yStart, columnWidth, taskHeight)
+	}
+
+	return tdCtx.Image()
+}
 
-		tdCtx.SetLineWidth(lineWidth)
-		tdCtx.DrawRoundedRectangle(outsideBoundaryWidth, yStart, rectangleWidth, taskHeight, 5)
-		tdCtx.Stroke()
+func drawTaskRow(tdCtx *gg.Context, fonts *Fonts, theme *Theme, fontSize float64, row taskRow, xStart, yStart, width, height float64) {
+	if row.header != "" {
+		tdCtx.SetFontFace(fonts.Face(Bold, fontSize))
+		rectangleWidth := width - 2*theme.OutsideBoundaryWidth
+		tdCtx.DrawRoundedRectangle(xStart+theme.OutsideBoundaryWidth, yStart, rectangleWidth, height, theme.CornerRadius)
+		tdCtx.SetColor(theme.HeaderFill)
+		tdCtx.Fill()
+
+		tdCtx.SetColor(theme.Foreground)
+		header := truncateString(tdCtx, row.header, rectangleWidth-2*theme.InnerBoundaryWidth)
+		drawText(tdCtx, header, xStart+theme.InnerBoundaryWidth+theme.OutsideBoundaryWidth, yStart+height/2, 0, 0.5)
+		return
+	}
 
-		textWidth := rectangleWidth - 2*innerBoundaryWidth
-		taskWidth := textWidth * taskPortion
-		projectWidth := textWidth * projectPortion
+	// Draw a rectangle, indented by the depth of the task.
+	indent := float64(row.depth) * subtaskIndent
+	rectangleWidth := width - 2*theme.OutsideBoundaryWidth - indent
 
-		taskName := truncateString(tdCtx, task.Content, float64(taskWidth))
-		tdCtx.DrawStringAnchored(taskName, innerBoundaryWidth+outsideBoundaryWidth, yStart+taskHeight/2, 0, 0.5)
+	tdCtx.SetLineWidth(theme.LineWidth)
+	tdCtx.DrawRoundedRectangle(xStart+theme.OutsideBoundaryWidth+indent, yStart, rectangleWidth, height, theme.CornerRadius)
+	tdCtx.Stroke()
 
-		projectSeparatorX := innerBoundaryWidth + outsideBoundaryWidth + taskWidth
-		tdCtx.DrawLine(projectSeparatorX, yStart, projectSeparatorX, yStart+taskHeight)
-		tdCtx.Stroke()
+	textX := xStart + theme.InnerBoundaryWidth + theme.OutsideBoundaryWidth + indent
+	textWidth := rectangleWidth - 2*theme.InnerBoundaryWidth
 
-		projectName := truncateString(tdCtx, createProjectText(task), projectWidth)
-		tdCtx.DrawStringAnchored(projectName, 2*innerBoundaryWidth+outsideBoundaryWidth+taskWidth, yStart+taskHeight/2, 0, 0.5)
+	// The rows that stand in for hidden tasks are in italics.
+	tdCtx.SetFontFace(fonts.Face(Italic, fontSize))
+	switch {
+	case row.collapsed > 0:
+		summary := truncateString(tdCtx, createCollapsedText(row.collapsed), textWidth)
+		drawText(tdCtx, summary, textX, yStart+height/2, 0, 0.5)
+		return
+	case row.more > 0:
+		more := truncateString(tdCtx, createMoreText(row.more), textWidth)
+		drawText(tdCtx, more, textX, yStart+height/2, 0, 0.5)
+		return
 	}
 
-	return tdCtx.Image()
+	tdCtx.SetFontFace(fonts.Face(Regular, fontSize))
+	taskWidth := textWidth * theme.TaskPortion
+	projectWidth := textWidth * (1 - theme.TaskPortion)
+
+	// Long task names wrap onto a second line if the row is tall enough.
+	taskName := textBlock{text: row.task.Content, style: Regular, size: fontSize, minSize: minTaskFontSize, maxLines: 2, ay: 0.5}
+	taskName.draw(tdCtx, fonts, textX, yStart+theme.InnerBoundaryWidth, taskWidth, height-2*theme.InnerBoundaryWidth)
+	tdCtx.SetFontFace(fonts.Face(Regular, fontSize))
+
+	projectSeparatorX := textX + taskWidth
+	tdCtx.DrawLine(projectSeparatorX, yStart, projectSeparatorX, yStart+height)
+	tdCtx.Stroke()
+
+	// The project's colour is shown as a dot in front of its name, on displays that can show it.
+	projectX := projectSeparatorX + theme.InnerBoundaryWidth
+	if ink, ok := projectInk(theme, row.task); ok {
+		radius := fontSize / 3
+		tdCtx.DrawCircle(projectX+radius, yStart+height/2, radius)
+		tdCtx.SetColor(ink)
+		tdCtx.Fill()
+		tdCtx.SetColor(theme.Foreground)
+
+		projectX += 2*radius + theme.InnerBoundaryWidth
+		projectWidth -= 2*radius + theme.InnerBoundaryWidth
+	}
+
+	projectName := truncateString(tdCtx, createProjectText(row.task), projectWidth)
+	drawText(tdCtx, projectName, projectX, yStart+height/2, 0, 0.5)
+}
+
+// taskGrid picks the number of columns and rows per column needed to show rows
+// task rows in a panel height high. As many rows as fit at fullTaskHeight are
+// shown at that height, after that the rows get shorter and then flow into
+// more columns.
+func taskGrid(rows int, height float64) (columns, rowsPerColumn int) {
+	maxTasks := int(height / fullTaskHeight)
+	if maxTasks < 1 {
+		maxTasks = 1
+	}
+	maxRowsPerColumn := int(height / minTaskHeight)
+	if maxRowsPerColumn < maxTasks {
+		maxRowsPerColumn = maxTasks
+	}
+	switch {
+	case rows <= maxTasks:
+		return 1, maxTasks
+	case rows <= maxRowsPerColumn:
+		return 1, rows
+	}
+
+	columns = (rows + maxRowsPerColumn - 1) / maxRowsPerColumn
+	if columns > maxTaskColumns {
+		columns = maxTaskColumns
+	}
+
+	rowsPerColumn = (rows + columns - 1) / columns
+	switch {
+	case rowsPerColumn < maxTasks:
+		rowsPerColumn = maxTasks
+	case rowsPerColumn > maxRowsPerColumn:
+		rowsPerColumn = maxRowsPerColumn
+	}
+	return columns, rowsPerColumn
+}
+
+// countTaskRows returns the number of rows needed to show every task and header.
+func countTaskRows(groups []todoist.TaskGroup) int {
+	rows := countTasks(groups)
+	for _, group := range groups {
+		if group.Name != "" {
+			rows++
+		}
+	}
+	return rows
+}
+
+// countTasks returns the number of tasks, including subtasks.
+func countTasks(groups []todoist.TaskGroup) int {
+	count := 0
+	for _, group := range groups {
+		for _, task := range group.Tasks {
+			count += 1 + task.SubtaskCount()
+		}
+	}
+	return count
+}
+
+// countShownTasks returns the number of tasks that are either drawn or summarised in rows.
+func countShownTasks(rows []taskRow) int {
+	count := 0
+	for _, row := range rows {
+		switch {
+		case row.header != "":
+		case row.collapsed > 0:
+			count += row.collapsed
+		default:
+			count++
+		}
+	}
+	return count
+}
+
+// layoutTasks lays out the tasks in at most maxRows rows. If some of them don't
+// fit, the last row says how many were left out.
+func layoutTasks(groups []todoist.TaskGroup, maxRows int) []taskRow {
+	rows := layoutTaskRows(groups, maxRows)
+	if countShownTasks(rows) < countTasks(groups) {
+		// Make room for the "+N more tasks" row.
+		rows = layoutTaskRows(groups, maxRows-1)
+		rows = append(rows, taskRow{more: countTasks(groups) - countShownTasks(rows)})
+	}
+	return rows
 }
 
-func truncateString(tdCtx *gg.Context, str string, maxWidth float64) string {
-	strWidth, _ := tdCtx.MeasureString(str)
-	if strWidth <= maxWidth {
-		return str
+// layoutTaskRows flattens the grouped task trees into at most maxRows rows. Group
+// headers and top-level tasks always get a row first, then the remaining rows are
+// handed out in order: a task's subtasks are expanded if they all fit, otherwise
+// they are collapsed into a single "N subtasks" row.
+func layoutTaskRows(groups []todoist.TaskGroup, maxRows int) []taskRow {
+	spare := maxRows
+	shown := make([]todoist.TaskGroup, 0, len(groups))
+	for _, group := range groups {
+		if spare == 0 {
+			break
+		}
+		if group.Name != "" {
+			// A header without any of its tasks is of no use.
+			if spare < 2 {
+				break
+			}
+			spare--
+		}
+
+		tasks := group.Tasks
+		if len(tasks) > spare {
+			tasks = tasks[:spare]
+		}
+		spare -= len(tasks)
+		shown = append(shown, todoist.TaskGroup{Name: group.Name, Tasks: tasks})
 	}
 
-	for i := len(str) - 1; i >= 0; i-- {
-		truncatedString := str[:i] + "..."
-		w, _ := tdCtx.MeasureString(truncatedString)
-		if w <= maxWidth {
-			return truncatedString
+	rows := make([]taskRow, 0, maxRows)
+	for _, group := range shown {
+		if group.Name != "" {
+			rows = append(rows, taskRow{header: group.Name})
 		}
+		rows = appendTaskRows(rows, group.Tasks, &spare)
 	}
 
-	return ""
+	return rows
+}
+
+// appendTaskRows adds the top-level tasks and as many of their subtasks as spare allows.
+func appendTaskRows(rows []taskRow, tasks []todoist.Task, spare *int) []taskRow {
+	for _, task := range tasks {
+		rows = append(rows, taskRow{task: task})
+
+		count := task.SubtaskCount()
+		switch {
+		case count == 0:
+		case count <= *spare:
+			rows = appendSubtaskRows(rows, task.Subtasks, 1)
+			*spare -= count
+		case *spare > 0:
+			rows = append(rows, taskRow{depth: 1, collapsed: count})
+			*spare--
+		}
+	}
+
+	return rows
+}
+
+func appendSubtaskRows(rows []taskRow, subtasks []todoist.Task, depth int) []taskRow {
+	for _, subtask := range subtasks {
+		rows = append(rows, taskRow{task: subtask, depth: depth})
+		rows = appendSubtaskRows(rows, subtask.Subtasks, depth+1)
+	}
+	return rows
 }
 
 func createProjectText(task todoist.Task) string {
 	return fmt.Sprintf("%s - %s", task.Project, task.Due.Format("Jan 2"))
 }
+
+func createMoreText(count int) string {
+	if count == 1 {
+		return "+1 more task"
+	}
+	return fmt.Sprintf("+%d more tasks", count)
+}
+
+func createCollapsedText(count int) string {
+	if count == 1 {
+		return "1 subtask"
+	}
+	return fmt.Sprintf("%d subtasks", count)
+}
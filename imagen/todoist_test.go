@@ -0,0 +1,80 @@
+package imagen
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gouthamve/gophercal/todoist"
+)
+
+func TestLayoutTasks(t *testing.T) {
+	task := func(name string, subtasks ...todoist.Task) todoist.Task {
+		return todoist.Task{Content: name, Subtasks: subtasks}
+	}
+	tasks := func(n int) []todoist.Task {
+		var tasks []todoist.Task
+		for i := 0; i < n; i++ {
+			tasks = append(tasks, task(fmt.Sprint(i)))
+		}
+		return tasks
+	}
+
+	tests := []struct {
+		name    string
+		groups  []todoist.TaskGroup
+		maxRows int
+		want    []string
+	}{
+		{
+			name:    "everything fits",
+			groups:  []todoist.TaskGroup{{Tasks: []todoist.Task{task("a", task("a1")), task("b")}}},
+			maxRows: 5,
+			want:    []string{"a", "  a1", "b"},
+		},
+		{
+			name:    "subtasks are collapsed first",
+			groups:  []todoist.TaskGroup{{Tasks: []todoist.Task{task("a", task("a1"), task("a2")), task("b")}}},
+			maxRows: 3,
+			want:    []string{"a", "  2 subtasks", "b"},
+		},
+		{
+			name:    "top-level tasks that don't fit are counted",
+			groups:  []todoist.TaskGroup{{Tasks: tasks(5)}},
+			maxRows: 3,
+			want:    []string{"0", "1", "+3 more tasks"},
+		},
+		{
+			name:    "subtasks of tasks that don't fit are counted",
+			groups:  []todoist.TaskGroup{{Tasks: []todoist.Task{task("a"), task("b"), task("c", task("c1"))}}},
+			maxRows: 2,
+			want:    []string{"a", "+3 more tasks"},
+		},
+		{
+			name:    "groups that don't fit are counted",
+			groups:  []todoist.TaskGroup{{Name: "Today", Tasks: tasks(1)}, {Name: "Tomorrow", Tasks: tasks(2)}},
+			maxRows: 3,
+			want:    []string{"Today", "0", "+2 more tasks"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, row := range layoutTasks(tc.groups, tc.maxRows) {
+				switch {
+				case row.header != "":
+					got = append(got, row.header)
+				case row.collapsed > 0:
+					got = append(got, "  "+createCollapsedText(row.collapsed))
+				case row.more > 0:
+					got = append(got, createMoreText(row.more))
+				default:
+					got = append(got, fmt.Sprintf("%*s%s", 2*row.depth, "", row.task.Content))
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
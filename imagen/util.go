@@ -6,10 +6,39 @@ import (
 	"github.com/fogleman/gg"
 )
 
+// MergeImages puts the tasks panel and the calendar panel side by side.
 func MergeImages(todoImg, gcalImg image.Image) image.Image {
-	finalCtx := gg.NewContext(todoWidth+calWidth, todoHeight)
+	todoBounds, gcalBounds := todoImg.Bounds(), gcalImg.Bounds()
+	height := todoBounds.Dy()
+	if gcalBounds.Dy() > height {
+		height = gcalBounds.Dy()
+	}
+
+	finalCtx := gg.NewContext(todoBounds.Dx()+gcalBounds.Dx(), height)
 	finalCtx.DrawImage(todoImg, 0, 0)
-	finalCtx.DrawImage(gcalImg, todoWidth, 0)
+	finalCtx.DrawImage(gcalImg, todoBounds.Dx(), 0)
 
 	return finalCtx.Image()
 }
+
+const lowBatteryIconSize = 48.0
+
+// AddLowBatteryIcon draws a low battery warning in the bottom right corner of
+// the dashboard, so it's seen before the display runs flat.
+func AddLowBatteryIcon(img image.Image, theme *Theme) image.Image {
+	bounds := img.Bounds()
+	ctx := gg.NewContextForImage(img)
+
+	const margin = 10.0
+	x := float64(bounds.Dx()) - lowBatteryIconSize - margin
+	y := float64(bounds.Dy()) - lowBatteryIconSize - margin
+	ctx.DrawRoundedRectangle(x, y, lowBatteryIconSize, lowBatteryIconSize, theme.CornerRadius)
+	ctx.SetColor(theme.Background)
+	ctx.FillPreserve()
+	ctx.SetColor(theme.Foreground)
+	ctx.SetLineWidth(theme.LineWidth)
+	ctx.Stroke()
+
+	drawLowBatteryIcon(ctx, x+lowBatteryIconSize*0.1, y+lowBatteryIconSize*0.1, lowBatteryIconSize*0.8)
+	return ctx.Image()
+}
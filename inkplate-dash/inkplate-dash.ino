@@ -37,14 +37,21 @@ char *pass = "your_password_goes_here"; // Your WiFi password
 // Add the URL of the image you want to show on Inkplate
 String url = "http://<server-url>:8364/dash.jpg"; // the url of the server generating the image
 
-// Here you can change the interval of updating the image.
+// Here you can change the interval of updating the image. It's only used until
+// the server says when the dashboard is going to change next.
 #define UPDATE_INTERVAL_IN_SESCS 300
 
 /***********************************************/
 
+// Sent to the server when checking in, so you can tell which devices run old firmware.
+#define FIRMWARE_VERSION "1.0.0"
+
 // Variable that holds last connection time
 unsigned long lastConnectionTime = 0;
 
+// How long to wait before the next update, as the server last told us
+unsigned long updateIntervalInSecs = UPDATE_INTERVAL_IN_SESCS;
+
 
 void setup()
 {
@@ -85,7 +92,7 @@ void setup()
 void loop()
 {
     // Every POSTING_INTERVAL_IN_SESCS seconds make the POST request
-    if ((unsigned long)(millis() - lastConnectionTime) > UPDATE_INTERVAL_IN_SESCS * 1000LL)
+    if ((unsigned long)(millis() - lastConnectionTime) > updateIntervalInSecs * 1000LL)
     {
       getandprintdash();
     }
@@ -97,11 +104,26 @@ void getandprintdash() {
     http.begin(url);
     http.setTimeout(60000);
 
+    // Check in with the server, so it can track the battery and warn when it's low
+    http.addHeader("X-Device-ID", WiFi.macAddress());
+    http.addHeader("X-Battery-Voltage", String(display.readBattery(), 2));
+    http.addHeader("X-Wifi-RSSI", String(WiFi.RSSI()));
+    http.addHeader("X-Firmware-Version", FIRMWARE_VERSION);
+
+    // Keep the content type so we can tell images apart from plain text errors,
+    // and when the server wants us to update next
+    const char *headerKeys[] = {"Content-Type", "X-Refresh-In"};
+    http.collectHeaders(headerKeys, 2);
+
     // Do a get request to get the image
     int httpCode = http.GET();
 
-    // If everything is OK
-    if (httpCode == HTTP_CODE_OK)
+    // Sleep until the next meeting, or through the night, if the server says so
+    long refreshIn = http.header("X-Refresh-In").toInt();
+    updateIntervalInSecs = refreshIn > 0 ? refreshIn : UPDATE_INTERVAL_IN_SESCS;
+
+    // If everything is OK, or the server sent an image explaining what went wrong
+    if (httpCode == HTTP_CODE_OK || (httpCode > 0 && http.header("Content-Type") == "image/jpg"))
     {
         // Get the size of the image
         int32_t size = http.getSize();
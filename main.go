@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
+	"image/jpeg"
+	"image/png"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/fogleman/gg"
@@ -19,9 +25,13 @@ import (
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
 
+	"github.com/gouthamve/gophercal/checkin"
+	"github.com/gouthamve/gophercal/dasherr"
 	"github.com/gouthamve/gophercal/gcalendar"
 	"github.com/gouthamve/gophercal/imagen"
+	"github.com/gouthamve/gophercal/schedule"
 	"github.com/gouthamve/gophercal/todoist"
+	"github.com/gouthamve/gophercal/weather"
 )
 
 var gopherCal struct {
@@ -31,8 +41,35 @@ var gopherCal struct {
 		GCalTokenFile string `kong:"help='Where to save Google Calendar token file',default='token.json',name='gcal-token-file'"`
 		GCalEmail     string `kong:"required,help='Google Calendar email address',name='gcal-email'"`
 
-		TodoistFilter string `kong:"help='Todoist filter to use',default='(today | overdue)',name='todoist-filter'"`
-		Location      string `kong:"help='Location to use for weather',default='',name='location'"`
+		TodoistFilter  string          `kong:"help='Todoist filter to use',default='(today | overdue)',name='todoist-filter'"`
+		TodoistSort    todoist.SortKey `kong:"help='Sort Todoist tasks by due, priority, project or order',default='due',enum='due,priority,project,order',name='todoist-sort'"`
+		TodoistGroupBy todoist.GroupBy `kong:"help='Group Todoist tasks by none, project, section, label or due. Tasks with several labels are grouped under their first one',default='none',enum='none,project,section,label,due',name='todoist-group-by'"`
+		Location       string          `kong:"help='Time zone to show the dashboard in, e.g. Europe/Berlin. Defaults to the local time zone',default='',name='location'"`
+
+		CalendarView    imagen.CalendarViewMode `kong:"help='Calendar view: rolling, workday, 3day, week or agenda',default='rolling',enum='rolling,workday,3day,week,agenda',name='calendar-view'"`
+		CalendarHours   int                     `kong:"help='Number of hours shown in the rolling and agenda calendar views',default='8',name='calendar-hours'"`
+		WorkdayStart    int                     `kong:"help='First hour shown in the workday, 3day and week calendar views',default='8',name='workday-start'"`
+		WorkdayEnd      int                     `kong:"help='Hour the workday, 3day and week calendar views end at',default='18',name='workday-end'"`
+		AgendaThreshold int                     `kong:"help='Switch to the agenda view when more than this many events overlap, 0 disables it',default='0',name='agenda-threshold'"`
+		HideFreeEvents  bool                    `kong:"help='Hide events that are marked as free',name='hide-free-events'"`
+		NowNext         bool                    `kong:"help='Show the current and next meeting above the calendar',name='now-next'"`
+
+		APIToken string        `kong:"env='GOPHERCAL_API_TOKEN',help='Token required to complete tasks through the API, the task endpoints are disabled if empty',name='api-token'"`
+		CacheTTL time.Duration `kong:"help='How long rendered dashboards, and the tasks and events they are rendered from, are kept before fetching and rendering them again',default='1m',name='cache-ttl'"`
+
+		Fonts      []string `kong:"help='TTF, OTF or TTC font files to draw text with, in fallback order. The built-in Go font is used for anything they are missing',name='font'"`
+		BoldFont   string   `kong:"help='Font file for headers, falls back to the --font fonts',name='bold-font'"`
+		ItalicFont string   `kong:"help='Font file for secondary text, falls back to the --font fonts',name='italic-font'"`
+		Theme      string   `kong:"help='Theme: default, high-contrast, minimal, dark, or the path to a JSON theme file',default='default',name='theme'"`
+		Device     string   `kong:"help='Device the dashboard is rendered for, see the README for the list. Requests can pick another one with ?device=',default='inkplate10',name='device'"`
+		Palette    string   `kong:"help='Inks of the display, overriding the device: gray, gray16, bw, bwr, bwy or 7color. Dashboards for colour displays are dithered and mark events and projects with their colours',default='',name='palette'"`
+
+		LowBatteryVoltage float64       `kong:"help='Battery voltage below which devices show a low battery warning',default='3.4',name='low-battery-voltage'"`
+		MaxDevices        int           `kong:"help='Number of device IDs whose check-ins are tracked and exported as metrics. Check-ins from more devices are ignored',default='20',name='max-devices'"`
+		RefreshInterval   time.Duration `kong:"help='Longest time devices are told to sleep for between refreshes',default='5m',name='refresh-interval'"`
+		QuietHours        string        `kong:"help='Time of day devices sleep through, e.g. 22:00-07:00. The dashboard shows the next morning during them',default='',name='quiet-hours'"`
+		NightImage        string        `kong:"help='PNG or JPEG image shown during the quiet hours instead of the next morning',default='',name='night-image'"`
+		WeatherLocation   string        `kong:"help='Latitude and longitude to show the weather forecast for on the night screen, e.g. 52.52,13.41. The forecast is left out if empty',default='',name='weather-location'"`
 	} `cmd:""`
 }
 
@@ -58,7 +95,17 @@ func main() {
 
 	switch ctx.Command() {
 	case "run":
-		td := todoist.New(gopherCal.Run.TodoistToken)
+		td := todoist.New(gopherCal.Run.TodoistToken, gopherCal.Run.TodoistSort)
+
+		loc := time.Local
+		if gopherCal.Run.Location != "" {
+			var err error
+			loc, err = time.LoadLocation(gopherCal.Run.Location)
+			if err != nil {
+				err = fmt.Errorf("unable to load time zone: %w", err)
+				checkErr(err)
+			}
+		}
 
 		b, err := os.ReadFile(gopherCal.Run.GCalCredsFile)
 		if err != nil {
@@ -71,10 +118,79 @@ func main() {
 			checkErr(err)
 		}
 
-		var calendar *gcalendar.Calendar
-		http.Handle("/dash.jpg", promhttp.InstrumentHandlerDuration(durationHistogram.MustCurryWith(prometheus.Labels{"handler": "dash.jpg"}), http.HandlerFunc(dashHandler(config, td, calendar, gopherCal.Run.Location))))
+		view := imagen.CalendarView{
+			Mode:     gopherCal.Run.CalendarView,
+			Hours:    gopherCal.Run.CalendarHours,
+			DayStart: gopherCal.Run.WorkdayStart,
+			DayEnd:   gopherCal.Run.WorkdayEnd,
+
+			AgendaThreshold: gopherCal.Run.AgendaThreshold,
+			NowNext:         gopherCal.Run.NowNext,
+		}
+		if view.Hours < 1 || view.DayStart < 0 || view.DayEnd > 24 || view.DayStart >= view.DayEnd {
+			checkErr(fmt.Errorf("invalid calendar view hours: %+v", view))
+		}
+
+		fonts, err := imagen.NewFonts(gopherCal.Run.Fonts, gopherCal.Run.BoldFont, gopherCal.Run.ItalicFont)
+		checkErr(err)
+		theme, err := imagen.LoadTheme(gopherCal.Run.Theme)
+		checkErr(err)
+		device, err := imagen.LoadDevice(gopherCal.Run.Device)
+		checkErr(err)
+		quiet, err := schedule.ParseQuietHours(gopherCal.Run.QuietHours)
+		checkErr(err)
+		var nightImage image.Image
+		if gopherCal.Run.NightImage != "" {
+			nightImage, err = gg.LoadImage(gopherCal.Run.NightImage)
+			checkErr(err)
+		}
+		var forecasts *weather.Weather
+		if gopherCal.Run.WeatherLocation != "" {
+			location, err := weather.ParseLocation(gopherCal.Run.WeatherLocation)
+			checkErr(err)
+			forecasts = weather.New(location)
+		}
+		var palette *imagen.Palette
+		if gopherCal.Run.Palette != "" {
+			palette, err = imagen.LoadPalette(gopherCal.Run.Palette)
+			checkErr(err)
+		}
+
+		dash := &dashboard{
+			config:   config,
+			td:       td,
+			fonts:    fonts,
+			theme:    theme,
+			device:   device,
+			palette:  palette,
+			devices:  checkin.NewStore(gopherCal.Run.LowBatteryVoltage, gopherCal.Run.MaxDevices),
+			loc:      loc,
+			now:      time.Now,
+			groupBy:  gopherCal.Run.TodoistGroupBy,
+			view:     view,
+			cacheTTL: gopherCal.Run.CacheTTL,
+
+			refreshInterval: gopherCal.Run.RefreshInterval,
+			quiet:           quiet,
+			nightImage:      nightImage,
+			weather:         forecasts,
+		}
+		http.Handle("/dash", promhttp.InstrumentHandlerDuration(durationHistogram.MustCurryWith(prometheus.Labels{"handler": "dash"}), http.HandlerFunc(dashHandler(dash, ""))))
+		http.Handle("/dash.jpg", promhttp.InstrumentHandlerDuration(durationHistogram.MustCurryWith(prometheus.Labels{"handler": "dash.jpg"}), http.HandlerFunc(dashHandler(dash, imagen.FormatJPEG))))
+		http.Handle("/dash.png", promhttp.InstrumentHandlerDuration(durationHistogram.MustCurryWith(prometheus.Labels{"handler": "dash.png"}), http.HandlerFunc(dashHandler(dash, imagen.FormatPNG))))
+		http.Handle("/dash/regions", promhttp.InstrumentHandlerDuration(durationHistogram.MustCurryWith(prometheus.Labels{"handler": "dash/regions"}), http.HandlerFunc(regionsHandler(dash))))
+		http.Handle("/dash/tile", promhttp.InstrumentHandlerDuration(durationHistogram.MustCurryWith(prometheus.Labels{"handler": "dash/tile"}), http.HandlerFunc(tileHandler(dash))))
+		http.HandleFunc("/preview", previewHandler(dash))
+		http.HandleFunc("/preview/image", previewImageHandler(dash))
+		http.HandleFunc("/preview/status", previewStatusHandler(dash))
 		http.Handle("/metrics", promhttp.Handler())
-		http.HandleFunc("/refresh-auth", authHandler(config, gopherCal.Run.GCalTokenFile))
+		http.HandleFunc("/refresh-auth", authHandler(dash, gopherCal.Run.GCalTokenFile))
+
+		if gopherCal.Run.APIToken != "" {
+			http.HandleFunc("/tasks", requireToken(gopherCal.Run.APIToken, tasksPageHandler(td, dash)))
+			http.HandleFunc("/tasks/login", loginHandler(gopherCal.Run.APIToken))
+			http.HandleFunc("/tasks/", requireToken(gopherCal.Run.APIToken, closeTaskHandler(td, dash)))
+		}
 
 		log.Println("Listening on :8364")
 		log.Fatal(http.ListenAndServe(":8364", nil))
@@ -87,53 +203,601 @@ func checkErr(err error) {
 	}
 }
 
-func dashHandler(config *oauth2.Config, td todoist.Todoist, calendar *gcalendar.Calendar, location string) func(w http.ResponseWriter, r *http.Request) {
+// dashboard renders the dashboard image and keeps the last render for each
+// device, and the tasks and events they're all rendered from, around for cacheTTL.
+type dashboard struct {
+	config *oauth2.Config
+	td     todoist.Todoist
+	fonts  *imagen.Fonts
+	theme  *imagen.Theme
+	// device is the device images are rendered for unless a request names
+	// another one. palette overrides the palette of every device if it's set.
+	device   imagen.Device
+	palette  *imagen.Palette
+	devices  *checkin.Store
+	loc      *time.Location
+	now      func() time.Time
+	groupBy  todoist.GroupBy
+	view     imagen.CalendarView
+	cacheTTL time.Duration
+
+	// refreshInterval is the longest devices sleep for, except through the quiet hours.
+	refreshInterval time.Duration
+	quiet           schedule.QuietHours
+	// nightImage is shown during the quiet hours if it's set, instead of the
+	// night screen.
+	nightImage image.Image
+	// weather gets the forecast for the night screen. It's nil if the
+	// forecast isn't shown.
+	weather *weather.Weather
+
+	// renderMtx is held while drawing. Renders share the font faces, so they
+	// can't run concurrently.
+	renderMtx sync.Mutex
+
+	// mtx guards the fields below. It isn't held while fetching from Todoist
+	// or Google Calendar, so a slow upstream doesn't hold up other requests.
+	mtx      sync.Mutex
+	calendar *gcalendar.Calendar
+	cache    map[string]cachedImage // by cacheKey
+	// data is what was last fetched for the displays. Every device is
+	// rendered from it, so Todoist and Google Calendar are asked once a
+	// cacheTTL however many devices there are.
+	data fetchedData
+	// events are the events of the last render, which devices are woken up for.
+	events []gcalendar.Event
+
+	// night is what the night screen shows, looked up once a night.
+	night nightScreen
+
+	// displays holds the images each display was sent, so it can be sent
+	// only the parts that changed next time.
+	displays    map[string]displayImages // by dashRequest.client
+	lastVersion int
+
+	// fetchedAt is when each service was last fetched from successfully, by
+	// the name it has in errors.
+	fetchedAt map[string]time.Time
+}
+
+// nightScreen is what the night screen shows for the morning the displays wake
+// up on. Lookups that failed are tried again after nightRetryInterval.
+type nightScreen struct {
+	morning   time.Time
+	fetchedAt time.Time
+
+	first       *gcalendar.Event
+	calendarErr error
+	forecast    *weather.Forecast
+	weatherErr  error
+}
+
+const nightRetryInterval = 15 * time.Minute
+
+// fetchedData is the tasks and events the dashboard shows.
+type fetchedData struct {
+	tasks     []todoist.Task
+	events    []gcalendar.Event
+	fetchedAt time.Time
+}
+
+// versionedImage is an image sent to a display, with the version it's known by.
+type versionedImage struct {
+	img     image.Image
+	version int
+}
+
+// displayImages are the images a display was sent. sent becomes shown once
+// the display says it has it on screen, so a display that didn't get all the
+// tiles of sent gets the changes from what it does have the next time.
+type displayImages struct {
+	shown versionedImage
+	sent  versionedImage
+}
+
+type cachedImage struct {
+	img        image.Image
+	device     imagen.Device
+	lowBattery bool
+	renderedAt time.Time
+	// took is how long rendering it took.
+	took time.Duration
+}
+
+// cacheKey is the key of the cached image for device.
+func cacheKey(device imagen.Device, lowBattery bool) string {
+	if lowBattery {
+		return device.Name + "/low-battery"
+	}
+	return device.Name
+}
+
+// Image returns the cached dashboard image for device, rendering it again if
+// it's stale. lowBattery adds a low battery warning to it.
+func (d *dashboard) Image(device imagen.Device, lowBattery bool) (image.Image, error) {
+	now := d.now().In(d.loc)
+	key := cacheKey(device, lowBattery)
+
+	d.mtx.Lock()
+	cached, ok := d.cache[key]
+	d.mtx.Unlock()
+	if ok && now.Sub(cached.renderedAt) < d.cacheTTL {
+		return cached.img, nil
+	}
+
+	start := time.Now()
+	img, events, err := d.render(now, device, lowBattery, true)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.events = events
+
+	if d.cache == nil {
+		d.cache = map[string]cachedImage{}
+	}
+	d.cache[key] = cachedImage{img: img, device: device, lowBattery: lowBattery, renderedAt: now, took: time.Since(start)}
+	return img, nil
+}
+
+// ImageAt renders the dashboard for device as it would look at the given time,
+// bypassing the cache. It doesn't change what the displays are shown.
+func (d *dashboard) ImageAt(at time.Time, device imagen.Device, lowBattery bool) (image.Image, error) {
+	img, _, err := d.render(at.In(d.loc), device, lowBattery, false)
+	return img, err
+}
+
+// Send records that img is being sent to the client display, which says it
+// has the version shownVersion on screen, or 0 if it doesn't know. It returns
+// the image the display has on screen, or nil if that isn't known, and the
+// version of img.
+func (d *dashboard) Send(client string, shownVersion int, img image.Image) (shown image.Image, version int) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.displays == nil {
+		d.displays = map[string]displayImages{}
+	}
+	images := d.displays[client]
+	switch {
+	case shownVersion != 0 && images.sent.version == shownVersion:
+		images.shown = images.sent
+	case shownVersion == 0 || images.shown.version != shownVersion:
+		images.shown = versionedImage{}
+	}
+
+	d.lastVersion++
+	images.sent = versionedImage{img: img, version: d.lastVersion}
+	d.displays[client] = images
+	return images.shown.img, d.lastVersion
+}
+
+// Sent returns the image the client display was last sent.
+func (d *dashboard) Sent(client string) (versionedImage, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	images, ok := d.displays[client]
+	return images.sent, ok
+}
+
+// NextRefresh returns when devices that fetch the dashboard at now should fetch it again.
+func (d *dashboard) NextRefresh(now time.Time) time.Time {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return schedule.NextRefresh(now.In(d.loc), d.events, d.refreshInterval, d.quiet)
+}
+
+// Refresh drops the cached images and what they were rendered from, and
+// renders each of them again, so devices don't wait for the render the next
+// time they fetch the dashboard.
+func (d *dashboard) Refresh() {
+	d.mtx.Lock()
+	cached := d.cache
+	d.cache = nil
+	d.data = fetchedData{}
+	d.mtx.Unlock()
+
+	for _, c := range cached {
+		if _, err := d.Image(c.device, c.lowBattery); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// render renders the dashboard for device, and returns the events on it. live
+// is false for previews, which don't keep what they look up for the displays.
+func (d *dashboard) render(now time.Time, device imagen.Device, lowBattery, live bool) (image.Image, []gcalendar.Event, error) {
+	if d.quiet.Contains(now) {
+		return d.renderNight(now, device, lowBattery, live), nil, nil
+	}
+
+	tasks, events, err := d.dashboardData(now, live)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	img := d.draw(device, lowBattery, func(theme *imagen.Theme, width, height float64) image.Image {
+		return drawDashboard(d.fonts, theme, tasks, events, d.groupBy, d.view, now, width, height)
+	})
+	return img, events, nil
+}
+
+// dashboardData returns the tasks and events shown on the dashboard at now.
+// Live renders share what was fetched until it's cacheTTL old, previews of
+// other times fetch their own.
+func (d *dashboard) dashboardData(now time.Time, live bool) ([]todoist.Task, []gcalendar.Event, error) {
+	if live {
+		d.mtx.Lock()
+		data := d.data
+		d.mtx.Unlock()
+		if !data.fetchedAt.IsZero() && now.Sub(data.fetchedAt) < d.cacheTTL {
+			return data.tasks, data.events, nil
+		}
+	}
+
+	calendar, err := d.ensureCalendar()
+	if err != nil {
+		return nil, nil, err
+	}
+	tasks, events, err := d.fetchData(calendar, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if live {
+		d.mtx.Lock()
+		d.data = fetchedData{tasks: tasks, events: events, fetchedAt: now}
+		d.mtx.Unlock()
+	}
+	return tasks, events, nil
+}
+
+// draw draws an image for device with drawFn at the device's size, adding the
+// low battery warning if lowBattery is set, and fits it to the device.
+func (d *dashboard) draw(device imagen.Device, lowBattery bool, drawFn func(theme *imagen.Theme, width, height float64) image.Image) image.Image {
+	d.renderMtx.Lock()
+	defer d.renderMtx.Unlock()
+
+	theme := d.themeFor(device)
+	width, height := device.Size()
+	img := drawFn(theme, float64(width), float64(height))
+	if lowBattery {
+		img = imagen.AddLowBatteryIcon(img, theme)
+	}
+	img = device.Fit(img, theme.Background)
+	if theme.Palette == nil || len(theme.Palette.Colors) == 0 {
+		return imagen.Quantize(img, device.BitDepth)
+	}
+	return imagen.Dither(img, theme.Palette)
+}
+
+// ensureCalendar connects to Google Calendar if we aren't connected yet, and
+// returns the connection.
+func (d *dashboard) ensureCalendar() (*gcalendar.Calendar, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.calendar != nil {
+		return d.calendar, nil
+	}
+
+	log.Println("making new calendar object")
+	_, err := os.Stat(gopherCal.Run.GCalTokenFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Println("Token file does not exist. open /refresh-auth to create a token file")
+			return nil, dasherr.New(dasherr.AuthExpired, gcalendar.ServiceName, err)
+		}
+		return nil, err
+	}
+
+	d.calendar, err = gcalendar.NewCalendar(d.config, gopherCal.Run.GCalTokenFile, gopherCal.Run.GCalEmail, d.loc, gopherCal.Run.HideFreeEvents)
+	if err != nil {
+		d.calendar = nil
+		return nil, err
+	}
+	return d.calendar, nil
+}
+
+// signedIn drops the Google Calendar client and the night screen's lookups,
+// which may have failed with the old token, so they're made again with the new one.
+func (d *dashboard) signedIn() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.calendar = nil
+	d.night = nightScreen{}
+}
+
+// renderNight renders the screen shown during the quiet hours. Todoist isn't
+// asked for anything, and Google Calendar and the weather forecast only once a
+// night. live is false for previews, whose lookups aren't kept.
+func (d *dashboard) renderNight(now time.Time, device imagen.Device, lowBattery, live bool) image.Image {
+	if d.nightImage != nil {
+		return d.draw(device, lowBattery, func(*imagen.Theme, float64, float64) image.Image {
+			return d.nightImage
+		})
+	}
+
+	morning := d.quiet.NextEnd(now)
+	d.mtx.Lock()
+	night := d.night
+	d.mtx.Unlock()
+
+	failed := night.calendarErr != nil || night.weatherErr != nil
+	if !night.morning.Equal(morning) || failed && d.now().Sub(night.fetchedAt) >= nightRetryInterval {
+		night = d.lookUpNight(morning)
+		if live {
+			d.mtx.Lock()
+			d.night = night
+			d.mtx.Unlock()
+		}
+	}
+	return d.draw(device, lowBattery, func(theme *imagen.Theme, width, height float64) image.Image {
+		return imagen.GenerateNightImage(d.fonts, theme, morning, night.first, night.calendarErr, night.forecast, width, height)
+	})
+}
+
+// lookUpNight looks up what the night screen shows for morning. The screen is
+// still useful without the parts that fail, so their errors are only logged.
+func (d *dashboard) lookUpNight(morning time.Time) nightScreen {
+	night := nightScreen{morning: morning, fetchedAt: d.now()}
+
+	night.first, night.calendarErr = d.firstEvent(morning)
+	if night.calendarErr != nil {
+		log.Println(night.calendarErr)
+	}
+
+	if d.weather != nil {
+		forecast, err := d.weather.Forecast(morning)
+		if err != nil {
+			night.weatherErr = fmt.Errorf("error getting the weather forecast: %w", err)
+			log.Println(night.weatherErr)
+		} else {
+			night.forecast = &forecast
+			d.fetched(weather.ServiceName)
+		}
+	}
+	return night
+}
+
+// firstEvent returns the first event that starts on the day of morning, after
+// morning. It returns nil if there isn't one.
+func (d *dashboard) firstEvent(morning time.Time) (*gcalendar.Event, error) {
+	calendar, err := d.ensureCalendar()
+	if err != nil {
+		return nil, err
+	}
+
+	endOfDay := time.Date(morning.Year(), morning.Month(), morning.Day()+1, 0, 0, 0, 0, morning.Location())
+	events, err := calendar.Events(morning, endOfDay)
+	if err != nil {
+		return nil, fmt.Errorf("error getting gcal events: %w", err)
+	}
+	d.fetched(gcalendar.ServiceName)
+
+	var first *gcalendar.Event
+	for i, event := range events {
+		if event.Start.Before(morning) {
+			continue
+		}
+		if first == nil || event.Start.Before(first.Start) {
+			first = &events[i]
+		}
+	}
+	return first, nil
+}
+
+// fetched records that service was just fetched from successfully.
+func (d *dashboard) fetched(service string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.fetchedAt == nil {
+		d.fetchedAt = map[string]time.Time{}
+	}
+	d.fetchedAt[service] = d.now()
+}
+
+// ErrorImage renders an error card for device in place of the dashboard.
+func (d *dashboard) ErrorImage(device imagen.Device, title, hint, details string) image.Image {
+	return d.draw(device, false, func(theme *imagen.Theme, width, height float64) image.Image {
+		return imagen.GenerateErrorImage(d.fonts, theme, title, hint, details, width, height)
+	})
+}
+
+// themeFor returns the theme with the palette of device.
+func (d *dashboard) themeFor(device imagen.Device) *imagen.Theme {
+	theme := *d.theme
+	theme.Palette = device.Palette
+	if d.palette != nil {
+		theme.Palette = d.palette
+	}
+	return &theme
+}
+
+// parseAt parses the time passed in the at query parameter. Times without a
+// time zone are in loc.
+func parseAt(at string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, at, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, at)
+}
+
+// encodeImage encodes img in format, returning the encoded image and its content type.
+func encodeImage(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case imagen.FormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	default:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpg", nil
+	}
+}
+
+// dashHandler serves the dashboard in format, or the format the device reads if it's empty.
+func dashHandler(dash *dashboard, format string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if calendar == nil {
-			log.Println("making new calendar object")
-			_, err := os.Stat(gopherCal.Run.GCalTokenFile)
-			if err != nil {
-				if os.IsNotExist(err) {
-					log.Println("Token file does not exist. open /refresh-auth to create a token file")
-				}
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
+		req, err := parseDashRequest(dash, r, format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-			calendar, err = gcalendar.NewCalendar(config, gopherCal.Run.GCalTokenFile, gopherCal.Run.GCalEmail, gopherCal.Run.Location)
+		var mergedImg image.Image
+		if at := r.URL.Query().Get("at"); at != "" {
+			var t time.Time
+			t, err = parseAt(at, dash.loc)
 			if err != nil {
-				log.Println(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("invalid at time: %v", err), http.StatusBadRequest)
 				return
 			}
+			mergedImg, err = dash.ImageAt(t, req.device, req.lowBattery)
+		} else {
+			mergedImg, err = dash.Image(req.device, req.lowBattery)
+			setRefreshHeaders(w, dash)
 		}
-
-		mergedImg, err := generateImage(td, calendar, location)
 		if err != nil {
 			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeErrorCard(w, dash, req.device, req.format, err)
 			return
 		}
 
-		if err := gg.SaveJPG("dash.jpg", mergedImg, 80); err != nil {
+		buf, contentType, err := encodeImage(mergedImg, req.format)
+		if err != nil {
 			log.Println(err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if r.URL.Query().Get("at") == "" && req.client != "" {
+			// Displays that fetch the regions next can say they have this version.
+			_, version := dash.Send(req.client, 0, mergedImg)
+			w.Header().Set("X-Dashboard-Version", strconv.Itoa(version))
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		w.Write(buf)
+	}
+}
 
-		buf, err := os.ReadFile("dash.jpg")
+// dashRequest is what a request for the dashboard asks for.
+type dashRequest struct {
+	device     imagen.Device
+	format     string
+	lowBattery bool
+	// client is the display the request came from: the ID it checked in
+	// with, or empty if it didn't.
+	client string
+}
+
+// parseDashRequest reads the device and format a request asks for, and
+// records the device's check-in. An empty format is the device's own.
+func parseDashRequest(dash *dashboard, r *http.Request, format string) (dashRequest, error) {
+	req := dashRequest{device: dash.device, format: format}
+	if name := r.URL.Query().Get("device"); name != "" {
+		var err error
+		req.device, err = imagen.LoadDevice(name)
 		if err != nil {
+			return dashRequest{}, err
+		}
+	}
+	if req.format == "" {
+		req.format = req.device.Format
+	}
+
+	report, ok, err := checkin.FromRequest(r, dash.now())
+	switch {
+	case err != nil:
+		log.Println(err)
+	case ok:
+		if err := dash.devices.CheckIn(report); err != nil {
 			log.Println(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			break
 		}
-		w.Header().Set("Content-Type", "image/jpg")
-		w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
-		w.Write(buf)
+		req.lowBattery = dash.devices.LowBattery(report.ID)
+		req.client = report.ID
+	}
+	return req, nil
+}
+
+// setRefreshHeaders tells the device when to fetch the dashboard again, both
+// as a time and as the number of seconds to sleep for.
+func setRefreshHeaders(w http.ResponseWriter, dash *dashboard) {
+	now := dash.now()
+	next := dash.NextRefresh(now)
+	w.Header().Set("X-Next-Refresh", next.Format(time.RFC3339))
+	w.Header().Set("X-Refresh-In", strconv.Itoa(int(next.Sub(now).Seconds())))
+}
+
+// writeErrorCard serves an image explaining err in place of the dashboard, so
+// the display shows what went wrong instead of keeping a stale image.
+func writeErrorCard(w http.ResponseWriter, dash *dashboard, device imagen.Device, format string, err error) {
+	var dashErr *dasherr.Error
+	if errors.As(err, &dashErr) && dashErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(dashErr.RetryAfter.Seconds())))
+	}
+
+	title, hint := describeError(err)
+	img := dash.ErrorImage(device, title, hint, err.Error())
+
+	buf, contentType, imgErr := encodeImage(img, format)
+	if imgErr != nil {
+		log.Println(imgErr)
+		http.Error(w, err.Error(), dasherr.HTTPStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(dasherr.HTTPStatus(err))
+	w.Write(buf)
+}
+
+// describeError returns the title and hint shown on the error card for err.
+func describeError(err error) (title, hint string) {
+	service := "A service"
+	var dashErr *dasherr.Error
+	if errors.As(err, &dashErr) && dashErr.Service != "" {
+		service = dashErr.Service
+	}
+
+	switch dasherr.KindOf(err) {
+	case dasherr.AuthExpired:
+		hint = "Check the " + service + " credentials."
+		if service == gcalendar.ServiceName {
+			hint = "Open /refresh-auth on the gophercal server to sign in again."
+		}
+		return "Signed out of " + service, hint
+	case dasherr.Unavailable:
+		return service + " is unavailable", "The dashboard will update once it's back."
+	case dasherr.RateLimited:
+		hint = "Trying again on the next refresh."
+		if dashErr.RetryAfter > 0 {
+			hint = fmt.Sprintf("Trying again in %s.", dashErr.RetryAfter.Round(time.Second))
+		}
+		return service + " is rate limiting gophercal", hint
+	case dasherr.InvalidConfig:
+		return "gophercal is misconfigured", "Check the flags and the server logs."
+	default:
+		return "Something went wrong", "Check the gophercal server logs."
 	}
 }
 
-func authHandler(config *oauth2.Config, tokenFile string) func(w http.ResponseWriter, r *http.Request) {
+func authHandler(dash *dashboard, tokenFile string) func(w http.ResponseWriter, r *http.Request) {
+	config := dash.config
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		if r.URL.Query().Get("code") != "" {
@@ -146,7 +810,11 @@ func authHandler(config *oauth2.Config, tokenFile string) func(w http.ResponseWr
 				return
 			}
 
-			saveToken(tokenFile, tok)
+			if err := saveToken(tokenFile, tok); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			dash.signedIn()
 			w.Write([]byte("Successfully authenticated. You can close this tab now."))
 			return
 		}
@@ -157,25 +825,37 @@ func authHandler(config *oauth2.Config, tokenFile string) func(w http.ResponseWr
 	}
 }
 
-func generateImage(td todoist.Todoist, calendar *gcalendar.Calendar, location string) (image.Image, error) {
+// fetchData fetches the tasks and events shown on the dashboard at now, in the
+// time zone of now, and records each service it fetched from successfully.
+func (d *dashboard) fetchData(calendar *gcalendar.Calendar, now time.Time) ([]todoist.Task, []gcalendar.Event, error) {
 	log.Println("Starting ")
-	tasks, err := td.GetTodaysTasks()
+	tasks, err := d.td.GetTodaysTasks(now)
 	if err != nil {
-		return nil, fmt.Errorf("error getting todoist tasks: %w", err)
+		return nil, nil, fmt.Errorf("error getting todoist tasks: %w", err)
 	}
+	d.fetched(todoist.ServiceName)
 
-	todoistImg := imagen.GenerateTodoistImage(tasks)
-
-	log.Println("Tasks image generated")
+	log.Println("tasks retrieved")
 
-	events, err := calendar.Events()
+	events, err := calendar.Events(d.view.Window(now))
 	if err != nil {
-		return nil, fmt.Errorf("error getting gcal events: %w", err)
+		return nil, nil, fmt.Errorf("error getting gcal events: %w", err)
 	}
+	d.fetched(gcalendar.ServiceName)
 
 	log.Println("events retrieved")
+	return tasks, events, nil
+}
+
+// drawDashboard draws the tasks and calendar panels side by side, each taking
+// half of the width x height dashboard.
+func drawDashboard(fonts *imagen.Fonts, theme *imagen.Theme, tasks []todoist.Task, events []gcalendar.Event, groupBy todoist.GroupBy, view imagen.CalendarView, now time.Time, width, height float64) image.Image {
+	todoWidth := float64(int(width) / 2)
+	todoistImg := imagen.GenerateTodoistImage(fonts, theme, tasks, groupBy, now, todoWidth, height)
 
-	gcalImg := imagen.GenerateCalendarImage(events, location)
+	log.Println("Tasks image generated")
+
+	gcalImg := imagen.GenerateCalendarImage(fonts, theme, events, view, now, width-todoWidth, height)
 
 	log.Println("events image generated")
 
@@ -184,16 +864,19 @@ func generateImage(td todoist.Todoist, calendar *gcalendar.Calendar, location st
 
 	log.Println("images merged")
 
-	return mergedImg, nil
+	return mergedImg
 }
 
 // Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
+func saveToken(path string, token *oauth2.Token) error {
 	fmt.Printf("Saving credential file to: %s\n", path)
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return fmt.Errorf("unable to cache oauth token: %w", err)
 	}
 	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	if err := json.NewEncoder(f).Encode(token); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/gouthamve/gophercal/dasherr"
+	"github.com/gouthamve/gophercal/imagen"
+	"github.com/gouthamve/gophercal/todoist"
+)
+
+// testDashboard returns a dashboard that renders at now, in UTC.
+func testDashboard(t *testing.T, now time.Time) *dashboard {
+	t.Helper()
+
+	fonts, err := imagen.NewFonts(nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theme, err := imagen.LoadTheme(imagen.DefaultTheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := imagen.LoadDevice(imagen.DefaultDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dashboard{
+		config: &oauth2.Config{},
+		fonts:  fonts,
+		theme:  theme,
+		device: device,
+		loc:    time.UTC,
+		now:    func() time.Time { return now },
+	}
+}
+
+// countingTransport answers Todoist with no tasks and Google Calendar with no
+// events, counting the requests to each by host.
+type countingTransport struct {
+	mtx      sync.Mutex
+	requests map[string]int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mtx.Lock()
+	c.requests[r.URL.Host]++
+	c.mtx.Unlock()
+
+	body := `{"items":[]}`
+	if strings.Contains(r.URL.Host, "todoist") {
+		body = `[]`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// fetches returns how many requests went to Todoist and to Google Calendar.
+func (c *countingTransport) fetches() (todoistRequests, calendarRequests int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for host, n := range c.requests {
+		if strings.Contains(host, "todoist") {
+			todoistRequests += n
+		} else {
+			calendarRequests += n
+		}
+	}
+	return todoistRequests, calendarRequests
+}
+
+func TestDevicesShareFetchedData(t *testing.T) {
+	transport := &countingTransport{requests: map[string]int{}}
+	defer func(old http.RoundTripper) { http.DefaultTransport = old }(http.DefaultTransport)
+	http.DefaultTransport = transport
+
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+	token := fmt.Sprintf(`{"access_token":"abc","token_type":"Bearer","expiry":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { gopherCal.Run.GCalTokenFile = old }(gopherCal.Run.GCalTokenFile)
+	gopherCal.Run.GCalTokenFile = tokenFile
+
+	now := time.Date(2024, time.March, 4, 10, 0, 0, 0, time.UTC)
+	dash := testDashboard(t, now)
+	dash.td = todoist.New("token", todoist.SortByDue)
+	dash.view = imagen.CalendarView{Hours: 8, DayStart: 8, DayEnd: 18}
+	dash.cacheTTL = time.Minute
+
+	renderAll := func() {
+		t.Helper()
+		for _, name := range []string{imagen.DefaultDevice, "kindle", "inky-frame-4"} {
+			device, err := imagen.LoadDevice(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := dash.Image(device, false); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+	}
+	wantFetches := func(when string, want int) {
+		t.Helper()
+		if todoistRequests, calendarRequests := transport.fetches(); todoistRequests != want || calendarRequests != want {
+			t.Errorf("%s: got %d Todoist and %d Google Calendar requests, want %d of each", when, todoistRequests, calendarRequests, want)
+		}
+	}
+
+	renderAll()
+	wantFetches("rendering three devices", 1)
+
+	// Refreshing after a task is closed fetches again, once for every device.
+	dash.Refresh()
+	wantFetches("refreshing", 2)
+
+	// Previews of other times don't use what the displays are shown.
+	if _, err := dash.ImageAt(now.Add(time.Hour), dash.device, false); err != nil {
+		t.Fatal(err)
+	}
+	wantFetches("previewing another time", 3)
+	renderAll()
+	wantFetches("rendering from the cache", 3)
+}
+
+func TestSigningInAgainRecovers(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"new","token_type":"Bearer","refresh_token":"new-refresh","expires_in":3600}`)
+	}))
+	defer tokenServer.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+	defer func(old string) { gopherCal.Run.GCalTokenFile = old }(gopherCal.Run.GCalTokenFile)
+	gopherCal.Run.GCalTokenFile = tokenFile
+
+	dash := &dashboard{
+		config: &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}},
+		loc:    time.UTC,
+	}
+	signIn := func() {
+		t.Helper()
+		w := httptest.NewRecorder()
+		authHandler(dash, tokenFile)(w, httptest.NewRequest("GET", "/refresh-auth?code=abc", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("signing in: got status %d: %s", w.Code, w.Body)
+		}
+	}
+
+	// Signed out: there's no token yet.
+	if _, err := dash.ensureCalendar(); dasherr.KindOf(err) != dasherr.AuthExpired {
+		t.Fatalf("got %v, want an auth expired error", err)
+	}
+
+	signIn()
+	first, err := dash.ensureCalendar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := dash.ensureCalendar(); again != first {
+		t.Error("the calendar should be kept between renders")
+	}
+
+	// Once the token is revoked, signing in again replaces the client that
+	// still has the old token.
+	signIn()
+	second, err := dash.ensureCalendar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("the calendar should be made again with the new token")
+	}
+	if saved, err := os.ReadFile(tokenFile); err != nil || len(saved) == 0 {
+		t.Errorf("the token wasn't saved: %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gouthamve/gophercal/imagen"
+)
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>gophercal preview</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #eee; }
+form { margin-bottom: 1em; }
+form label { margin-right: 1em; white-space: nowrap; }
+figure { display: inline-block; margin: 0 1em 1em 0; vertical-align: top; }
+.panel { position: relative; overflow: hidden; background: #fff; border: 12px solid #333; border-radius: 8px; }
+.panel img { position: absolute; left: 50%; top: 50%; }
+figcaption, .fetches { color: #666; font-size: 0.9em; margin-top: 0.25em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Preview</h1>
+<form method="get" action="/preview">
+<p>
+{{- range .Devices }}
+<label><input type="checkbox" name="device" value="{{ .Name }}"{{ if .Selected }} checked{{ end }}>{{ .Name }}</label>
+{{- end }}
+</p>
+<p>
+<label>At <input type="datetime-local" name="at" value="{{ .At }}"></label>
+<button type="submit">Show</button>
+{{- if .At }} <a href="/preview?{{ .LiveQuery }}">Back to now</a>{{ end }}
+</p>
+</form>
+{{- range .Previews }}
+<figure>
+<div class="panel" style="width: {{ .ViewWidth }}px; height: {{ .ViewHeight }}px">
+<img src="{{ .URL }}" data-device="{{ .Device.Name }}" width="{{ .Device.Width }}" height="{{ .Device.Height }}" style="transform: translate(-50%, -50%) rotate(-{{ .Device.Rotation }}deg)" alt="{{ .Device.Name }}">
+</div>
+<figcaption><b>{{ .Device.Name }}</b>, {{ .Device.Width }}x{{ .Device.Height }}<span class="render" data-device="{{ .Device.Name }}">{{ with .Render }}, rendered at {{ .RenderedAt.Format "15:04:05" }} in {{ .TookMS }}ms{{ end }}</span></figcaption>
+</figure>
+{{- end }}
+<p class="fetches">
+{{- range .Fetches }}{{ .Service }} last fetched at {{ .At.Format "15:04:05" }}. {{ else }}Nothing fetched yet.{{ end -}}
+</p>
+{{- if not .At }}
+<script>
+// Reload the images when a new render lands.
+const renderedAt = {};
+async function poll() {
+  const resp = await fetch("/preview/status");
+  if (!resp.ok) {
+    return;
+  }
+  const status = await resp.json();
+  for (const img of document.querySelectorAll("img[data-device]")) {
+    const name = img.dataset.device;
+    const render = status.renders[name];
+    if (!render) {
+      continue;
+    }
+    if (renderedAt[name] && renderedAt[name] !== render.rendered_at) {
+      const src = new URL(img.src);
+      src.searchParams.set("t", Date.now());
+      img.src = src;
+    }
+    renderedAt[name] = render.rendered_at;
+    const caption = document.querySelector(".render[data-device='" + name + "']");
+    caption.textContent = ", rendered at " + new Date(render.rendered_at).toLocaleTimeString() + " in " + render.took_ms + "ms";
+  }
+  const fetches = document.querySelector(".fetches");
+  fetches.textContent = status.fetches.length ? status.fetches.map(f => f.service + " last fetched at " + new Date(f.at).toLocaleTimeString() + ".").join(" ") : "Nothing fetched yet.";
+}
+setInterval(poll, 5000);
+</script>
+{{- end }}
+</body>
+</html>
+`))
+
+// previewStatus is what the preview page polls to see when the dashboard was
+// last rendered for each device.
+type previewStatus struct {
+	Renders map[string]renderStatus `json:"renders"` // by device name
+	Fetches []fetchStatus           `json:"fetches"`
+}
+
+type renderStatus struct {
+	RenderedAt time.Time `json:"rendered_at"`
+	TookMS     int64     `json:"took_ms"`
+}
+
+type fetchStatus struct {
+	Service string    `json:"service"`
+	At      time.Time `json:"at"`
+}
+
+// Status returns when the dashboard was last rendered for each device and
+// when the services were last fetched from.
+func (d *dashboard) Status() previewStatus {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	status := previewStatus{Renders: map[string]renderStatus{}, Fetches: []fetchStatus{}}
+	for key, cached := range d.cache {
+		// Devices with a low battery have their own render, show the latest.
+		name := strings.TrimSuffix(key, "/low-battery")
+		if prev, ok := status.Renders[name]; ok && prev.RenderedAt.After(cached.renderedAt) {
+			continue
+		}
+		status.Renders[name] = renderStatus{RenderedAt: cached.renderedAt, TookMS: cached.took.Milliseconds()}
+	}
+	for service, at := range d.fetchedAt {
+		status.Fetches = append(status.Fetches, fetchStatus{Service: service, At: at})
+	}
+	sort.Slice(status.Fetches, func(i, j int) bool {
+		return status.Fetches[i].Service < status.Fetches[j].Service
+	})
+	return status
+}
+
+type previewDevice struct {
+	Device imagen.Device
+	URL    string
+	Render *renderStatus
+}
+
+// ViewWidth and ViewHeight are the size of the panel the way it's looked at,
+// which is the size the dashboard is drawn at.
+func (p previewDevice) ViewWidth() int {
+	width, _ := p.Device.Size()
+	return width
+}
+
+func (p previewDevice) ViewHeight() int {
+	_, height := p.Device.Size()
+	return height
+}
+
+// previewHandler serves a page showing the dashboard for each device at the
+// size of its panel. The images are reloaded when they're rendered again.
+func previewHandler(dash *dashboard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		at := query.Get("at")
+		if at != "" {
+			if _, err := parseAt(at, dash.loc); err != nil {
+				http.Error(w, fmt.Sprintf("invalid at time: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		status := dash.Status()
+		names := query["device"]
+		if len(names) == 0 {
+			// Show the configured device and every device that fetched the dashboard.
+			names = append(names, dash.device.Name)
+			for name := range status.Renders {
+				if name != dash.device.Name {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names[1:])
+		}
+
+		var previews []previewDevice
+		selected := map[string]bool{}
+		for _, name := range names {
+			device, err := imagen.LoadDevice(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			selected[name] = true
+
+			imgQuery := url.Values{}
+			imgQuery.Set("device", name)
+			if at != "" {
+				imgQuery.Set("at", at)
+			}
+			preview := previewDevice{Device: device, URL: "/preview/image?" + imgQuery.Encode()}
+			if render, ok := status.Renders[name]; ok && at == "" {
+				preview.Render = &render
+			}
+			previews = append(previews, preview)
+		}
+
+		type deviceOption struct {
+			Name     string
+			Selected bool
+		}
+		var devices []deviceOption
+		for _, name := range imagen.DeviceNames() {
+			devices = append(devices, deviceOption{Name: name, Selected: selected[name]})
+		}
+
+		liveQuery := url.Values{}
+		if len(query["device"]) > 0 {
+			liveQuery["device"] = query["device"]
+		}
+
+		data := struct {
+			Devices   []deviceOption
+			Previews  []previewDevice
+			Fetches   []fetchStatus
+			At        string
+			LiveQuery string
+		}{
+			Devices:   devices,
+			Previews:  previews,
+			Fetches:   status.Fetches,
+			At:        at,
+			LiveQuery: liveQuery.Encode(),
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := previewPage.Execute(w, data); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// previewImageHandler serves the dashboard like /dash.png, but without
+// counting as an image sent to a display, so previewing doesn't change
+// what's sent as partial updates.
+func previewImageHandler(dash *dashboard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device := dash.device
+		if name := r.URL.Query().Get("device"); name != "" {
+			var err error
+			device, err = imagen.LoadDevice(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var (
+			img image.Image
+			err error
+		)
+		if at := r.URL.Query().Get("at"); at != "" {
+			var t time.Time
+			t, err = parseAt(at, dash.loc)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid at time: %v", err), http.StatusBadRequest)
+				return
+			}
+			img, err = dash.ImageAt(t, device, false)
+		} else {
+			img, err = dash.Image(device, false)
+		}
+		if err != nil {
+			log.Println(err)
+			writeErrorCard(w, dash, device, imagen.FormatPNG, err)
+			return
+		}
+
+		buf, contentType, err := encodeImage(img, imagen.FormatPNG)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(buf)
+	}
+}
+
+// previewStatusHandler serves dashboard.Status as JSON.
+func previewStatusHandler(dash *dashboard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dash.Status()); err != nil {
+			log.Println(err)
+		}
+	}
+}
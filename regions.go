@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gouthamve/gophercal/dasherr"
+	"github.com/gouthamve/gophercal/imagen"
+)
+
+// regionsResponse lists the parts of the dashboard that changed since the
+// display last fetched it, for displays that can refresh part of the screen.
+type regionsResponse struct {
+	// Version identifies the render the regions are cut from.
+	Version int `json:"version"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	// Full is set when the whole screen should be refreshed, in which case
+	// there's a single region covering all of it.
+	Full    bool     `json:"full"`
+	Regions []region `json:"regions"`
+}
+
+type region struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// regionsHandler renders the dashboard and describes how it differs from the
+// image the display has on screen, which it names with the shown query
+// parameter. Each region links to a tile with its pixels. Displays that didn't
+// check in with an ID can't be told apart, so they always get the whole screen.
+func regionsHandler(dash *dashboard) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseDashRequest(dash, r, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		img, err := dash.Image(req.device, req.lowBattery)
+		setRefreshHeaders(w, dash)
+		if err != nil {
+			// Displays fetch the whole dashboard to show the error card.
+			log.Println(err)
+			http.Error(w, err.Error(), dasherr.HTTPStatus(err))
+			return
+		}
+
+		bounds := img.Bounds()
+		if req.client == "" {
+			writeRegions(w, regionsResponse{
+				Width:  bounds.Dx(),
+				Height: bounds.Dy(),
+				Full:   true,
+				Regions: []region{{
+					Width:  bounds.Dx(),
+					Height: bounds.Dy(),
+					URL:    "/dash?" + url.Values{"device": {req.device.Name}}.Encode(),
+				}},
+			})
+			return
+		}
+
+		shownVersion, _ := strconv.Atoi(r.URL.Query().Get("shown"))
+		shown, version := dash.Send(req.client, shownVersion, img)
+		resp := regionsResponse{
+			Version: version,
+			Width:   bounds.Dx(),
+			Height:  bounds.Dy(),
+			Regions: []region{},
+		}
+		for _, rect := range imagen.DiffRegions(shown, img) {
+			resp.Full = rect == bounds
+			resp.Regions = append(resp.Regions, region{
+				X:      rect.Min.X,
+				Y:      rect.Min.Y,
+				Width:  rect.Dx(),
+				Height: rect.Dy(),
+				URL:    tileURL(req, version, rect),
+			})
+		}
+		writeRegions(w, resp)
+	}
+}
+
+func writeRegions(w http.ResponseWriter, resp regionsResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(resp); err != nil {
+		log.Println(err)
+	}
+}
+
+// tileURL returns the link to the rect part of the render with the given version.
+func tileURL(req dashRequest, version int, rect image.Rectangle) string {
+	query := url.Values{}
+	query.Set("client", req.client)
+	query.Set("format", req.format)
+	query.Set("version", strconv.Itoa(version))
+	query.Set("x", strconv.Itoa(rect.Min.X))
+	query.Set("y", strconv.Itoa(rect.Min.Y))
+	query.Set("w", strconv.Itoa(rect.Dx()))
+	query.Set("h", strconv.Itoa(rect.Dy()))
+	return "/dash/tile?" + query.Encode()
+}
+
+// tileHandler serves a part of the image a display was last sent.
+func tileHandler(dash *dashboard) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var nums [5]int
+		for i, name := range []string{"version", "x", "y", "w", "h"} {
+			n, err := strconv.Atoi(query.Get(name))
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			nums[i] = n
+		}
+		version, rect := nums[0], image.Rect(nums[1], nums[2], nums[1]+nums[3], nums[2]+nums[4])
+
+		sent, ok := dash.Sent(query.Get("client"))
+		if !ok || sent.version != version {
+			http.Error(w, "the dashboard changed since, fetch the regions again", http.StatusConflict)
+			return
+		}
+		if rect.Empty() || !rect.In(sent.img.Bounds()) {
+			http.Error(w, "the tile is outside the dashboard", http.StatusBadRequest)
+			return
+		}
+
+		tile, ok := sent.img.(interface {
+			SubImage(image.Rectangle) image.Image
+		})
+		if !ok {
+			http.Error(w, "the dashboard can't be cut into tiles", http.StatusInternalServerError)
+			return
+		}
+		buf, contentType, err := encodeImage(tile.SubImage(rect), query.Get("format"))
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		w.Write(buf)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gouthamve/gophercal/checkin"
+	"github.com/gouthamve/gophercal/schedule"
+)
+
+// regionsDashboard returns a dashboard that shows its night image all day, so
+// what's on the screen can be changed without Todoist or Google Calendar.
+func regionsDashboard(t *testing.T) *dashboard {
+	t.Helper()
+
+	dash := testDashboard(t, time.Date(2024, time.March, 4, 10, 0, 0, 0, time.UTC))
+	quiet, err := schedule.ParseQuietHours("00:00-23:59")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dash.quiet = quiet
+	dash.devices = checkin.NewStore(3.4, 10)
+	dash.refreshInterval = time.Hour
+	showOnScreen(dash, image.Rectangle{})
+	return dash
+}
+
+// showOnScreen makes the dashboard white with a black square at square.
+func showOnScreen(dash *dashboard, square image.Rectangle) {
+	width, height := dash.device.Size()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, square, image.Black, image.Point{}, draw.Src)
+	dash.nightImage = img
+}
+
+func getRegions(t *testing.T, dash *dashboard, query url.Values) regionsResponse {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	regionsHandler(dash)(w, httptest.NewRequest("GET", "/dash/regions?"+query.Encode(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var resp regionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func getTile(dash *dashboard, tileURL string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	tileHandler(dash)(w, httptest.NewRequest("GET", tileURL, nil))
+	return w
+}
+
+// covers reports whether the regions cover all of rect.
+func covers(regions []region, rect image.Rectangle) bool {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			covered := false
+			for _, r := range regions {
+				if image.Pt(x, y).In(image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestRegionsWithoutClientID(t *testing.T) {
+	dash := regionsDashboard(t)
+
+	resp := getRegions(t, dash, url.Values{})
+	want := region{Width: 1200, Height: 825, URL: "/dash?device=inkplate10"}
+	if !resp.Full || resp.Version != 0 || len(resp.Regions) != 1 || resp.Regions[0] != want {
+		t.Errorf("got %+v, want version 0 with the whole screen at %s", resp, want.URL)
+	}
+	if len(dash.displays) != 0 {
+		t.Errorf("displays without an ID shouldn't be remembered, got %v", dash.displays)
+	}
+}
+
+func TestRegionsVersionHandshake(t *testing.T) {
+	dash := regionsDashboard(t)
+	query := func(shown int) url.Values {
+		q := url.Values{checkin.ParamID: {"frame"}}
+		if shown != 0 {
+			q.Set("shown", fmt.Sprint(shown))
+		}
+		return q
+	}
+
+	// The first fetch is of the whole screen.
+	first := getRegions(t, dash, query(0))
+	if !first.Full || len(first.Regions) != 1 || first.Regions[0].Width != 1200 || first.Regions[0].Height != 825 {
+		t.Fatalf("first fetch: got %+v, want the whole screen", first)
+	}
+	if w := getTile(dash, first.Regions[0].URL); w.Code != http.StatusOK {
+		t.Fatalf("first tile: got status %d: %s", w.Code, w.Body)
+	}
+
+	// Once the display says it shows the first version, it only gets what
+	// changed since.
+	square := image.Rect(100, 100, 200, 200)
+	showOnScreen(dash, square)
+	second := getRegions(t, dash, query(first.Version))
+	if second.Full || len(second.Regions) == 0 || !covers(second.Regions, square) {
+		t.Fatalf("acknowledged fetch: got %+v, want a partial update covering %v", second, square)
+	}
+	if second.Version <= first.Version {
+		t.Errorf("got version %d after %d, want a newer one", second.Version, first.Version)
+	}
+	for _, r := range second.Regions {
+		w := getTile(dash, r.URL)
+		if w.Code != http.StatusOK {
+			t.Fatalf("tile %s: got status %d: %s", r.URL, w.Code, w.Body)
+		}
+		tile, _, err := image.Decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tile.Bounds().Dx() != r.Width || tile.Bounds().Dy() != r.Height {
+			t.Errorf("tile %s is %v, want %dx%d", r.URL, tile.Bounds(), r.Width, r.Height)
+		}
+	}
+
+	// Fetching the tiles doesn't mean the display shows them. If it says it
+	// still shows the first version, it's sent the changes since that one.
+	third := getRegions(t, dash, query(first.Version))
+	if third.Full || !covers(third.Regions, square) {
+		t.Fatalf("unacknowledged fetch: got %+v, want a partial update from the first version covering %v", third, square)
+	}
+
+	// The tiles of the second version are gone now the third was sent.
+	if w := getTile(dash, second.Regions[0].URL); w.Code != http.StatusConflict {
+		t.Errorf("stale tile: got status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// A version the server doesn't know gets the whole screen.
+	if unknown := getRegions(t, dash, query(third.Version+100)); !unknown.Full {
+		t.Errorf("unknown version: got %+v, want the whole screen", unknown)
+	}
+}
+
+func TestTileOfAnotherDisplay(t *testing.T) {
+	dash := regionsDashboard(t)
+
+	resp := getRegions(t, dash, url.Values{checkin.ParamID: {"frame"}})
+	tileURL, err := url.Parse(resp.Regions[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := tileURL.Query()
+	query.Set("client", "other")
+	if w := getTile(dash, "/dash/tile?"+query.Encode()); w.Code != http.StatusConflict {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusConflict)
+	}
+}
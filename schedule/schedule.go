@@ -0,0 +1,123 @@
+// Package schedule works out when the dashboard is going to change, so devices
+// can sleep until then instead of refreshing on a fixed interval.
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+)
+
+const (
+	// WakeBefore is how long before an event starts or ends devices wake up,
+	// so the change is on the display when it happens.
+	WakeBefore = time.Minute
+	// MinSleep is the shortest time devices are told to sleep for.
+	MinSleep = 30 * time.Second
+)
+
+// QuietHours is the time of day devices sleep through, like "22:00-07:00".
+// The zero value has no quiet hours.
+type QuietHours struct {
+	// Start and End are offsets from midnight. End is before Start when the
+	// quiet hours go past midnight.
+	Start, End time.Duration
+}
+
+// ParseQuietHours parses quiet hours written as "HH:MM-HH:MM". An empty
+// string means no quiet hours.
+func ParseQuietHours(s string) (QuietHours, error) {
+	if s == "" {
+		return QuietHours{}, nil
+	}
+
+	var startH, startM, endH, endM int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &startH, &startM, &endH, &endM); err != nil {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q, use HH:MM-HH:MM: %w", s, err)
+	}
+	for _, v := range []struct{ h, m int }{{startH, startM}, {endH, endM}} {
+		if v.h < 0 || v.h > 23 || v.m < 0 || v.m > 59 {
+			return QuietHours{}, fmt.Errorf("invalid quiet hours %q, use HH:MM-HH:MM", s)
+		}
+	}
+
+	q := QuietHours{
+		Start: time.Duration(startH)*time.Hour + time.Duration(startM)*time.Minute,
+		End:   time.Duration(endH)*time.Hour + time.Duration(endM)*time.Minute,
+	}
+	if q.Start == q.End {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q, they start and end at the same time", s)
+	}
+	return q, nil
+}
+
+// Enabled returns whether there are any quiet hours.
+func (q QuietHours) Enabled() bool {
+	return q.Start != q.End
+}
+
+// Contains returns whether t is in the quiet hours, in the time zone of t.
+func (q QuietHours) Contains(t time.Time) bool {
+	if !q.Enabled() {
+		return false
+	}
+	offset := t.Sub(midnight(t))
+	if q.Start < q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
+
+// NextStart returns the first time the quiet hours start after t.
+func (q QuietHours) NextStart(t time.Time) time.Time {
+	return next(t, q.Start)
+}
+
+// NextEnd returns the first time the quiet hours end after t.
+func (q QuietHours) NextEnd(t time.Time) time.Time {
+	return next(t, q.End)
+}
+
+// next returns the first time after t that is offset past midnight.
+func next(t time.Time, offset time.Duration) time.Time {
+	day := midnight(t)
+	for {
+		// Days aren't always 24 hours long, so count the hours from the day's own midnight.
+		at := day.Add(offset)
+		if at.After(t) {
+			return at
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+	}
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// NextRefresh returns when a device showing the dashboard at now should fetch
+// it again: just before the next event starts or ends, and at most interval
+// from now. During quiet hours devices sleep until they end.
+func NextRefresh(now time.Time, events []gcalendar.Event, interval time.Duration, quiet QuietHours) time.Time {
+	if quiet.Contains(now) {
+		return quiet.NextEnd(now)
+	}
+
+	refresh := now.Add(interval)
+	earliest := now.Add(MinSleep)
+	consider := func(t time.Time) {
+		if t.Before(refresh) && !t.Before(earliest) {
+			refresh = t
+		}
+	}
+
+	for _, event := range events {
+		consider(event.Start.Add(-WakeBefore))
+		consider(event.End.Add(-WakeBefore))
+	}
+	if quiet.Enabled() {
+		consider(quiet.NextStart(now))
+	}
+	return refresh
+}
@@ -0,0 +1,97 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gouthamve/gophercal/gcalendar"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    QuietHours
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "22:00-07:00", want: QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}},
+		{in: "13:30-14:15", want: QuietHours{Start: 13*time.Hour + 30*time.Minute, End: 14*time.Hour + 15*time.Minute}},
+		{in: "22:00", wantErr: true},
+		{in: "25:00-07:00", wantErr: true},
+		{in: "07:00-07:00", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseQuietHours(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: got error %v, want error %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}
+	lunch := QuietHours{Start: 12 * time.Hour, End: 13 * time.Hour}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.March, 4, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		quiet QuietHours
+		at    time.Time
+		want  bool
+	}{
+		{quiet: overnight, at: at(23, 0), want: true},
+		{quiet: overnight, at: at(3, 0), want: true},
+		{quiet: overnight, at: at(7, 0), want: false},
+		{quiet: overnight, at: at(21, 59), want: false},
+		{quiet: lunch, at: at(12, 30), want: true},
+		{quiet: lunch, at: at(13, 0), want: false},
+		{quiet: QuietHours{}, at: at(3, 0), want: false},
+	}
+
+	for _, tc := range tests {
+		if got := tc.quiet.Contains(tc.at); got != tc.want {
+			t.Errorf("%+v contains %s: got %v, want %v", tc.quiet, tc.at.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestNextRefresh(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.March, 4, hour, minute, 0, 0, time.UTC)
+	}
+	events := []gcalendar.Event{
+		{Title: "Standup", Start: at(10, 0), End: at(10, 15)},
+		{Title: "Planning", Start: at(11, 0), End: at(12, 0)},
+	}
+	overnight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		events []gcalendar.Event
+		quiet  QuietHours
+		want   time.Time
+	}{
+		{name: "nothing coming up", now: at(8, 0), want: at(8, 5)},
+		{name: "wakes before an event starts", now: at(9, 57), events: events, want: at(9, 59)},
+		{name: "wakes before an event ends", now: at(10, 12), events: events, want: at(10, 14)},
+		{name: "doesn't wake right away", now: at(10, 59), events: events, want: at(11, 4)},
+		{name: "wakes when the quiet hours start", now: at(21, 58), quiet: overnight, want: at(22, 0)},
+		{name: "sleeps through the quiet hours", now: at(22, 1), events: events, quiet: overnight, want: time.Date(2024, time.March, 5, 7, 0, 0, 0, time.UTC)},
+		{name: "sleeps until the quiet hours end", now: at(3, 0), quiet: overnight, want: at(7, 0)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NextRefresh(tc.now, tc.events, 5*time.Minute, tc.quiet); !got.Equal(tc.want) {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
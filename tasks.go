@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gouthamve/gophercal/dasherr"
+	"github.com/gouthamve/gophercal/todoist"
+)
+
+var tasksPage = template.Must(template.New("tasks").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>gophercal tasks</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+form { margin: 0.5em 0; }
+input[type=checkbox] { transform: scale(1.5); margin-right: 0.75em; }
+.project { color: #666; }
+</style>
+</head>
+<body>
+<h1>Today's tasks</h1>
+{{- range .Tasks }}
+<form method="post" action="/tasks/{{ .Task.Id }}/close" style="padding-left: {{ .Depth }}em">
+<label><input type="checkbox" onchange="this.form.submit()">{{ .Task.Content }}</label>
+<span class="project">{{ .Task.Project }}</span>
+</form>
+{{- else }}
+<p>Nothing to do!</p>
+{{- end }}
+</body>
+</html>
+`))
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>gophercal tasks</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Today's tasks</h1>
+{{- if .Invalid }}
+<p class="error">That's not the API token.</p>
+{{- end }}
+<form method="post" action="/tasks/login">
+<label>API token <input type="password" name="token" autofocus></label>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// tokenCookie holds the API token in browsers that logged in to the tasks page,
+// so it doesn't have to be in any URL.
+const tokenCookie = "gophercal_token"
+
+// taskCloser closes Todoist tasks.
+type taskCloser interface {
+	CloseTask(id string) error
+}
+
+type tasksPageTask struct {
+	Task  todoist.Task
+	Depth int
+}
+
+// requireToken only lets requests through that carry the token, either as a
+// bearer token or in the cookie set by the login form. Browsers without it are
+// shown the login form.
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if cookie, err := r.Cookie(tokenCookie); got == "" && err == nil {
+			got = cookie.Value
+		}
+
+		if !validToken(got, token) {
+			if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				writeLoginPage(w, false)
+				return
+			}
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func validToken(got, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func writeLoginPage(w http.ResponseWriter, invalid bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := loginPage.Execute(w, struct{ Invalid bool }{invalid}); err != nil {
+		log.Println(err)
+	}
+}
+
+// loginHandler handles POST /tasks/login. It sets the token cookie if the
+// form has the right token and sends the browser to the tasks page.
+func loginHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !validToken(r.PostFormValue("token"), token) {
+			writeLoginPage(w, true)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    token,
+			Path:     "/tasks",
+			MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			// Other sites can't close tasks by posting to /tasks with the cookie.
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/tasks", http.StatusSeeOther)
+	}
+}
+
+func tasksPageHandler(td todoist.Todoist, dash *dashboard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tasks, err := td.GetTodaysTasks(dash.now().In(dash.loc))
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Tasks []tasksPageTask
+		}{
+			Tasks: flattenTasks(nil, tasks, 0),
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tasksPage.Execute(w, data); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// closeTaskHandler handles POST /tasks/{id}/close. Once the task is closed, the
+// dashboard is rendered again so the next device refresh doesn't show it anymore.
+func closeTaskHandler(td taskCloser, dash *dashboard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/close")
+		if !ok || id == "" || strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := td.CloseTask(id); err != nil {
+			err = fmt.Errorf("unable to close task %s: %w", id, err)
+			log.Println(err)
+			http.Error(w, err.Error(), dasherr.HTTPStatus(err))
+			return
+		}
+		log.Printf("closed task %s", id)
+
+		go dash.Refresh()
+
+		// Browsers come from the tasks page, so send them back there.
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/tasks", http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func flattenTasks(flat []tasksPageTask, tasks []todoist.Task, depth int) []tasksPageTask {
+	for _, task := range tasks {
+		flat = append(flat, tasksPageTask{Task: task, Depth: depth})
+		flat = flattenTasks(flat, task.Subtasks, depth+1)
+	}
+	return flat
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gouthamve/gophercal/dasherr"
+)
+
+const testToken = "sekrit"
+
+// fakeCloser closes tasks by remembering their IDs, or fails with err.
+type fakeCloser struct {
+	closed []string
+	err    error
+}
+
+func (f *fakeCloser) CloseTask(id string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.closed = append(f.closed, id)
+	return nil
+}
+
+func TestCloseTaskHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		bearer  string
+		cookie  string
+		html    bool
+		err     error
+		want    int
+		wantIDs string
+	}{
+		{name: "no token", method: "POST", path: "/tasks/123/close", want: http.StatusUnauthorized},
+		{name: "wrong bearer token", method: "POST", path: "/tasks/123/close", bearer: "wrong", want: http.StatusUnauthorized},
+		{name: "wrong cookie", method: "POST", path: "/tasks/123/close", cookie: "wrong", want: http.StatusUnauthorized},
+		{name: "bearer token", method: "POST", path: "/tasks/123/close", bearer: testToken, want: http.StatusNoContent, wantIDs: "123"},
+		{name: "cookie", method: "POST", path: "/tasks/123/close", cookie: testToken, want: http.StatusNoContent, wantIDs: "123"},
+		{name: "form on the tasks page", method: "POST", path: "/tasks/123/close", cookie: testToken, html: true, want: http.StatusSeeOther, wantIDs: "123"},
+		{name: "not a POST", method: "GET", path: "/tasks/123/close", bearer: testToken, want: http.StatusMethodNotAllowed},
+		{name: "no task ID", method: "POST", path: "/tasks//close", bearer: testToken, want: http.StatusNotFound},
+		{name: "no close", method: "POST", path: "/tasks/123", bearer: testToken, want: http.StatusNotFound},
+		{name: "nested path", method: "POST", path: "/tasks/1/2/close", bearer: testToken, want: http.StatusNotFound},
+		{
+			name:   "task that doesn't exist",
+			method: "POST",
+			path:   "/tasks/123/close",
+			bearer: testToken,
+			err:    dasherr.New(dasherr.NotFound, "Todoist", errors.New("404 Not Found")),
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "rate limited",
+			method: "POST",
+			path:   "/tasks/123/close",
+			bearer: testToken,
+			err:    dasherr.New(dasherr.RateLimited, "Todoist", errors.New("429 Too Many Requests")),
+			want:   http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			closer := &fakeCloser{err: tc.err}
+			handler := requireToken(testToken, closeTaskHandler(closer, &dashboard{}))
+
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: tokenCookie, Value: tc.cookie})
+			}
+			if tc.html {
+				r.Header.Set("Accept", "text/html")
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+			if got := strings.Join(closer.closed, " "); got != tc.wantIDs {
+				t.Errorf("closed %q, want %q", got, tc.wantIDs)
+			}
+			if w.Code == http.StatusSeeOther && w.Header().Get("Location") != "/tasks" {
+				t.Errorf("redirected to %q, want /tasks", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestRequireTokenShowsLoginPage(t *testing.T) {
+	handler := requireToken(testToken, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the handler shouldn't be called without the token")
+	})
+
+	r := httptest.NewRequest("GET", "/tasks", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if !strings.Contains(w.Body.String(), `action="/tasks/login"`) {
+		t.Errorf("got %s, want the login form", w.Body)
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	login := func(method, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/tasks/login", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		loginHandler(testToken)(w, r)
+		return w
+	}
+
+	if w := login("GET", testToken); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	w := login("POST", "wrong")
+	if w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Errorf("wrong token: got status %d and cookies %v, want %d and none", w.Code, w.Result().Cookies(), http.StatusUnauthorized)
+	}
+
+	w = login("POST", testToken)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/tasks" {
+		t.Errorf("got status %d to %q, want %d to /tasks", w.Code, w.Header().Get("Location"), http.StatusSeeOther)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tokenCookie || cookies[0].Value != testToken || !cookies[0].HttpOnly {
+		t.Errorf("got cookies %v, want an HttpOnly %s cookie with the token", cookies, tokenCookie)
+	}
+}
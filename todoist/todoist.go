@@ -1,48 +1,115 @@
 package todoist
 
 import (
+	"errors"
+	"net/http"
+	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/volyanyk/todoist"
+
+	"github.com/gouthamve/gophercal/dasherr"
+)
+
+// ServiceName names Todoist in the errors it returns.
+const ServiceName = "Todoist"
+
+// SortKey is the primary key tasks are ordered by. Ties are always broken by
+// due date, Todoist order and ID so the order is stable between renders.
+type SortKey string
+
+const (
+	SortByDue      SortKey = "due"
+	SortByPriority SortKey = "priority"
+	SortByProject  SortKey = "project"
+	SortByOrder    SortKey = "order"
+)
+
+// GroupBy is the attribute tasks are grouped by in the tasks panel.
+type GroupBy string
+
+const (
+	GroupByNone    GroupBy = "none"
+	GroupByProject GroupBy = "project"
+	GroupBySection GroupBy = "section"
+	// GroupByLabel files each task under its first label only, so it's shown once.
+	GroupByLabel GroupBy = "label"
+	GroupByDue   GroupBy = "due"
 )
 
 type Todoist struct {
 	client *todoist.Client
+	// httpClient makes the requests the client can't, with a timeout so a
+	// hanging Todoist doesn't hang the request that's waiting on it.
+	httpClient *http.Client
+	token      string
+	sortBy     SortKey
 }
 
 type Task struct {
-	Id      string
-	Project string
-	Section string
-	Content string
-	Due     time.Time
+	Id       string
+	ParentId string
+	Project  string
+	Section  string
+	// ProjectColor is the name of the project's colour in Todoist, like "berry_red".
+	ProjectColor string
+	Content      string
+	Due          time.Time
+	Priority     int
+	Order        int
+	Labels       []string
+
+	Subtasks []Task
 }
 
-func New(token string) Todoist {
+// SubtaskCount returns the number of subtasks nested under the task, at any depth.
+func (t Task) SubtaskCount() int {
+	count := len(t.Subtasks)
+	for _, subtask := range t.Subtasks {
+		count += subtask.SubtaskCount()
+	}
+	return count
+}
+
+// TaskGroup is a named set of top-level tasks. The name is empty when tasks aren't grouped.
+type TaskGroup struct {
+	Name  string
+	Tasks []Task
+}
+
+func New(token string, sortBy SortKey) Todoist {
 	return Todoist{
-		client: todoist.New(token),
+		client:     todoist.New(token),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		token:      token,
+		sortBy:     sortBy,
 	}
 }
 
-func (t Todoist) GetTodaysTasks() ([]Task, error) {
+// GetTodaysTasks returns the tasks that are due today or overdue at now. Due
+// dates are in the time zone of now.
+func (t Todoist) GetTodaysTasks(now time.Time) ([]Task, error) {
 	apiTasks, err := t.client.GetActiveTasks(todoist.GetActiveTasksRequest{
 		Filter: "(today | overdue)",
 	})
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
 	}
 
 	projects := map[string]string{} // map from id to name
+	projectColors := map[string]string{}
 	sections := map[string]string{}
 	for _, task := range *apiTasks {
 		if _, ok := projects[task.ProjectId]; !ok {
 			project, err := t.client.GetProjectById(task.ProjectId)
 			if err != nil {
-				return nil, err
+				return nil, classifyError(err)
 			}
 
 			projects[project.ID] = project.Name
+			projectColors[project.ID] = project.Color
 		}
 	}
 
@@ -53,7 +120,7 @@ func (t Todoist) GetTodaysTasks() ([]Task, error) {
 		if _, ok := sections[task.SectionId]; !ok {
 			section, err := t.client.GetSectionById(task.SectionId)
 			if err != nil {
-				return nil, err
+				return nil, classifyError(err)
 			}
 
 			sections[section.ID] = section.Name
@@ -63,26 +130,222 @@ func (t Todoist) GetTodaysTasks() ([]Task, error) {
 	tasks := make([]Task, 0, len(*apiTasks))
 
 	for _, task := range *apiTasks {
-		due := time.Now().Add(24 * time.Hour)
+		due := now.Add(24 * time.Hour)
 		if task.Due != nil {
-			due, err = time.ParseInLocation(time.DateOnly, task.Due.Date, time.Local)
+			due, err = time.ParseInLocation(time.DateOnly, task.Due.Date, now.Location())
 			if err != nil {
 				return nil, err
 			}
 		}
 
+		// The API returns null for top-level tasks.
+		parentId, _ := task.ParentId.(string)
+
+		labels := make([]string, 0, len(task.Labels))
+		for _, label := range task.Labels {
+			if name, ok := label.(string); ok {
+				labels = append(labels, name)
+			}
+		}
+
 		tasks = append(tasks, Task{
-			Id:      task.Id,
-			Project: projects[task.ProjectId],
-			Section: sections[task.SectionId],
-			Content: task.Content,
-			Due:     due,
+			Id:           task.Id,
+			ParentId:     parentId,
+			Project:      projects[task.ProjectId],
+			Section:      sections[task.SectionId],
+			ProjectColor: projectColors[task.ProjectId],
+			Content:      task.Content,
+			Due:          due,
+			Priority:     task.Priority,
+			Order:        task.Order,
+			Labels:       labels,
 		})
 	}
 
-	sort.Slice(tasks, func(i, j int) bool {
-		return tasks[i].Due.Before(tasks[j].Due)
+	SortTasks(tasks, t.sortBy)
+
+	return buildTaskTree(tasks), nil
+}
+
+// CloseTask marks the task as complete.
+func (t Todoist) CloseTask(id string) error {
+	// The client expects a JSON body, but Todoist responds with 204 No Content,
+	// so the request is made here and only a 2xx counts as success.
+	req, err := http.NewRequest(http.MethodPost, todoist.APIURL+"tasks/"+url.PathEscape(id)+"/close", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return classifyError(todoist.StatusCodeError{Code: resp.StatusCode, Status: resp.Status})
+	}
+	return nil
+}
+
+// classifyError wraps errors from the Todoist client in the matching dasherr kind.
+func classifyError(err error) error {
+	var (
+		rateErr   *todoist.RateLimitedError
+		statusErr todoist.StatusCodeError
+		urlErr    *url.Error
+	)
+	switch {
+	case errors.As(err, &rateErr):
+		e := dasherr.New(dasherr.RateLimited, ServiceName, err)
+		e.RetryAfter = rateErr.RetryAfter
+		return e
+	case errors.As(err, &statusErr):
+		return dasherr.FromStatus(ServiceName, statusErr.Code, err)
+	case errors.As(err, &urlErr):
+		return dasherr.New(dasherr.Unavailable, ServiceName, err)
+	}
+	return err
+}
+
+// SortTasks sorts the tasks in place by the given key.
+func SortTasks(tasks []Task, key SortKey) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return compareTasks(tasks[i], tasks[j], key) < 0
 	})
+}
+
+func compareTasks(a, b Task, key SortKey) int {
+	c := 0
+	switch key {
+	case SortByPriority:
+		// Todoist uses 4 for the most urgent priority.
+		c = compareInts(b.Priority, a.Priority)
+	case SortByProject:
+		c = strings.Compare(a.Project, b.Project)
+	case SortByOrder:
+		// The order is only meaningful within a project.
+		c = strings.Compare(a.Project, b.Project)
+		if c == 0 {
+			c = compareInts(a.Order, b.Order)
+		}
+	}
+	if c != 0 {
+		return c
+	}
+
+	switch {
+	case a.Due.Before(b.Due):
+		return -1
+	case a.Due.After(b.Due):
+		return 1
+	}
+	if c := compareInts(a.Order, b.Order); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Id, b.Id)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// GroupTasks splits the top-level tasks into groups, keeping their order. Subtasks stay with
+// their parent. Groups are ordered by their first task, except due date groups which are
+// always Overdue, Today, Tomorrow and Later.
+func GroupTasks(tasks []Task, by GroupBy, now time.Time) []TaskGroup {
+	if by == GroupByNone || by == "" {
+		return []TaskGroup{{Tasks: tasks}}
+	}
+
+	var names []string
+	if by == GroupByDue {
+		names = []string{"Overdue", "Today", "Tomorrow", "Later"}
+	}
+
+	groups := map[string][]Task{}
+	for _, task := range tasks {
+		name := groupName(task, by, now)
+		if _, ok := groups[name]; !ok && by != GroupByDue {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], task)
+	}
+
+	result := make([]TaskGroup, 0, len(groups))
+	for _, name := range names {
+		if len(groups[name]) == 0 {
+			continue
+		}
+		result = append(result, TaskGroup{Name: name, Tasks: groups[name]})
+	}
+	return result
+}
+
+func groupName(task Task, by GroupBy, now time.Time) string {
+	switch by {
+	case GroupByProject:
+		return task.Project
+	case GroupBySection:
+		if task.Section == "" {
+			return "No section"
+		}
+		return task.Section
+	case GroupByLabel:
+		if len(task.Labels) == 0 {
+			return "No label"
+		}
+		return task.Labels[0]
+	case GroupByDue:
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		switch {
+		case task.Due.Before(today):
+			return "Overdue"
+		case task.Due.Before(today.AddDate(0, 0, 1)):
+			return "Today"
+		case task.Due.Before(today.AddDate(0, 0, 2)):
+			return "Tomorrow"
+		}
+		return "Later"
+	}
+	return ""
+}
+
+// buildTaskTree nests the tasks under their parents, keeping their relative order.
+// Subtasks whose parent isn't in the list (e.g. it isn't due today) stay at the top level.
+func buildTaskTree(tasks []Task) []Task {
+	present := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		present[task.Id] = true
+	}
+
+	roots := []Task{}
+	children := map[string][]Task{}
+	for _, task := range tasks {
+		if task.ParentId != "" && present[task.ParentId] {
+			children[task.ParentId] = append(children[task.ParentId], task)
+			continue
+		}
+		roots = append(roots, task)
+	}
+
+	var attach func(task Task) Task
+	attach = func(task Task) Task {
+		for _, child := range children[task.Id] {
+			task.Subtasks = append(task.Subtasks, attach(child))
+		}
+		return task
+	}
+	for i := range roots {
+		roots[i] = attach(roots[i])
+	}
 
-	return tasks, nil
+	return roots
 }
@@ -0,0 +1,223 @@
+package todoist
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// describeTree writes the tasks as "id(subtask ids...)" so trees are easy to compare.
+func describeTree(tasks []Task) string {
+	parts := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		if len(task.Subtasks) == 0 {
+			parts = append(parts, task.Id)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s(%s)", task.Id, describeTree(task.Subtasks)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildTaskTree(t *testing.T) {
+	task := func(id, parent string) Task {
+		return Task{Id: id, ParentId: parent}
+	}
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  string
+	}{
+		{
+			name:  "flat",
+			tasks: []Task{task("a", ""), task("b", "")},
+			want:  "a b",
+		},
+		{
+			name:  "nested several levels deep",
+			tasks: []Task{task("a", ""), task("a1", "a"), task("a1x", "a1"), task("a1xy", "a1x"), task("b", "")},
+			want:  "a(a1(a1x(a1xy))) b",
+		},
+		{
+			name:  "children listed before their parent",
+			tasks: []Task{task("a1x", "a1"), task("a1", "a"), task("a", "")},
+			want:  "a(a1(a1x))",
+		},
+		{
+			name:  "orphans stay at the top level",
+			tasks: []Task{task("a", ""), task("x1", "x"), task("a1", "a")},
+			want:  "a(a1) x1",
+		},
+		{
+			name:  "sibling order is kept",
+			tasks: []Task{task("a", ""), task("a3", "a"), task("b", ""), task("a1", "a"), task("a2", "a")},
+			want:  "a(a3 a1 a2) b",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := describeTree(buildTaskTree(tc.tasks)); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortTasks(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, time.March, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		key   SortKey
+		tasks []Task
+		want  string
+	}{
+		{
+			name: "due, then order, then ID",
+			key:  SortByDue,
+			tasks: []Task{
+				{Id: "d", Due: day(5), Order: 1},
+				{Id: "c", Due: day(4), Order: 2},
+				{Id: "b", Due: day(4), Order: 1},
+				{Id: "a2", Due: day(4), Order: 1},
+			},
+			want: "a2 b c d",
+		},
+		{
+			name: "priority 4 first",
+			key:  SortByPriority,
+			tasks: []Task{
+				{Id: "p1", Priority: 1, Due: day(3)},
+				{Id: "p4", Priority: 4, Due: day(5)},
+				{Id: "p2", Priority: 2, Due: day(4)},
+			},
+			want: "p4 p2 p1",
+		},
+		{
+			name: "priority ties broken by due, order and ID",
+			key:  SortByPriority,
+			tasks: []Task{
+				{Id: "c", Priority: 2, Due: day(4), Order: 2},
+				{Id: "b", Priority: 2, Due: day(4), Order: 1},
+				{Id: "late", Priority: 2, Due: day(5)},
+				{Id: "a", Priority: 2, Due: day(4), Order: 1},
+				{Id: "early", Priority: 2, Due: day(3)},
+			},
+			want: "early a b c late",
+		},
+		{
+			name: "project, then due",
+			key:  SortByProject,
+			tasks: []Task{
+				{Id: "work", Project: "Work", Due: day(3)},
+				{Id: "home2", Project: "Home", Due: day(5)},
+				{Id: "home1", Project: "Home", Due: day(4)},
+			},
+			want: "home1 home2 work",
+		},
+		{
+			name: "order only within a project",
+			key:  SortByOrder,
+			tasks: []Task{
+				{Id: "work1", Project: "Work", Order: 1},
+				{Id: "home5", Project: "Home", Order: 5},
+				{Id: "home2", Project: "Home", Order: 2},
+			},
+			want: "home2 home5 work1",
+		},
+		{
+			name: "order ties broken by due and ID",
+			key:  SortByOrder,
+			tasks: []Task{
+				{Id: "b", Project: "Home", Order: 1, Due: day(4)},
+				{Id: "c", Project: "Home", Order: 1, Due: day(3)},
+				{Id: "a", Project: "Home", Order: 1, Due: day(4)},
+			},
+			want: "c a b",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SortTasks(tc.tasks, tc.key)
+			if got := describeTree(tc.tasks); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGroupTasks(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 23, 30, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		by    GroupBy
+		tasks []Task
+		want  string
+	}{
+		{
+			name:  "none",
+			by:    GroupByNone,
+			tasks: []Task{{Id: "a"}, {Id: "b"}},
+			want:  ": a b",
+		},
+		{
+			name:  "projects in the order of their first task",
+			by:    GroupByProject,
+			tasks: []Task{{Id: "a", Project: "Work"}, {Id: "b", Project: "Home"}, {Id: "c", Project: "Work"}},
+			want:  "Work: a c; Home: b",
+		},
+		{
+			name:  "sections",
+			by:    GroupBySection,
+			tasks: []Task{{Id: "a"}, {Id: "b", Section: "Errands"}},
+			want:  "No section: a; Errands: b",
+		},
+		{
+			name:  "first label only",
+			by:    GroupByLabel,
+			tasks: []Task{{Id: "a", Labels: []string{"phone", "quick"}}, {Id: "b", Labels: []string{"quick"}}, {Id: "c"}},
+			want:  "phone: a; quick: b; No label: c",
+		},
+		{
+			name: "due dates around midnight in a fixed order",
+			by:   GroupByDue,
+			tasks: []Task{
+				{Id: "later", Due: at(6, 0, 0)},
+				{Id: "tomorrow-start", Due: at(5, 0, 0)},
+				{Id: "today-end", Due: at(4, 23, 59)},
+				{Id: "tomorrow-end", Due: at(5, 23, 59)},
+				{Id: "today-start", Due: at(4, 0, 0)},
+				{Id: "overdue", Due: at(3, 23, 59)},
+			},
+			want: "Overdue: overdue; Today: today-end today-start; Tomorrow: tomorrow-start tomorrow-end; Later: later",
+		},
+		{
+			name:  "empty due groups are left out",
+			by:    GroupByDue,
+			tasks: []Task{{Id: "later", Due: at(9, 0, 0)}, {Id: "today", Due: at(4, 9, 0)}},
+			want:  "Today: today; Later: later",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var groups []string
+			for _, group := range GroupTasks(tc.tasks, tc.by, now) {
+				groups = append(groups, group.Name+": "+describeTree(group.Tasks))
+			}
+			if got := strings.Join(groups, "; "); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package weather gets the day's forecast shown on the night screen from
+// Open-Meteo, which doesn't need an API key.
+package weather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gouthamve/gophercal/dasherr"
+)
+
+// ServiceName is the service errors from this package blame.
+const ServiceName = "Open-Meteo"
+
+// APIURL is the Open-Meteo forecast endpoint.
+const APIURL = "https://api.open-meteo.com/v1/forecast"
+
+// Forecast is the weather of a day.
+type Forecast struct {
+	// Code is the WMO weather interpretation code of the day.
+	Code int
+	// Low and High are the lowest and highest temperatures, in °C.
+	Low, High float64
+	// PrecipitationChance is the chance of rain or snow, in percent.
+	PrecipitationChance int
+}
+
+// Description returns a short description of the forecast's weather code.
+func (f Forecast) Description() string {
+	switch f.Code {
+	case 0:
+		return "Clear"
+	case 1:
+		return "Mostly clear"
+	case 2:
+		return "Partly cloudy"
+	case 3:
+		return "Overcast"
+	case 45, 48:
+		return "Fog"
+	case 51, 53, 55, 56, 57:
+		return "Drizzle"
+	case 61, 63, 65, 66, 67, 80, 81, 82:
+		return "Rain"
+	case 71, 73, 75, 77, 85, 86:
+		return "Snow"
+	case 95, 96, 99:
+		return "Thunderstorms"
+	}
+	return "Unknown weather"
+}
+
+// String formats the forecast as a line like "Rain, 4–12°C, 80% chance of rain".
+func (f Forecast) String() string {
+	s := fmt.Sprintf("%s, %.0f–%.0f°C", f.Description(), f.Low, f.High)
+	if f.PrecipitationChance > 0 {
+		s += fmt.Sprintf(", %d%% chance of rain", f.PrecipitationChance)
+	}
+	return s
+}
+
+// Location is where the forecast is for.
+type Location struct {
+	Latitude, Longitude float64
+}
+
+// ParseLocation parses a location written as "<latitude>,<longitude>", like
+// "52.52,13.41".
+func ParseLocation(s string) (Location, error) {
+	lat, lon, ok := strings.Cut(s, ",")
+	if !ok {
+		return Location{}, fmt.Errorf("invalid location %q, want <latitude>,<longitude>", s)
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return Location{}, fmt.Errorf("invalid latitude %q", lat)
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return Location{}, fmt.Errorf("invalid longitude %q", lon)
+	}
+	return Location{Latitude: latitude, Longitude: longitude}, nil
+}
+
+type Weather struct {
+	location Location
+	apiURL   string
+	client   *http.Client
+}
+
+func New(location Location) *Weather {
+	return &Weather{
+		location: location,
+		apiURL:   APIURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Forecast returns the forecast for the day of day, in the time zone of day.
+func (w *Weather) Forecast(day time.Time) (Forecast, error) {
+	date := day.Format("2006-01-02")
+	query := url.Values{
+		"latitude":   {strconv.FormatFloat(w.location.Latitude, 'f', -1, 64)},
+		"longitude":  {strconv.FormatFloat(w.location.Longitude, 'f', -1, 64)},
+		"daily":      {"weather_code,temperature_2m_min,temperature_2m_max,precipitation_probability_max"},
+		"timezone":   {timezone(day.Location())},
+		"start_date": {date},
+		"end_date":   {date},
+	}
+
+	resp, err := w.client.Get(w.apiURL + "?" + query.Encode())
+	if err != nil {
+		return Forecast{}, classifyError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Open-Meteo rejects coordinates and time zones it doesn't know with a 400.
+		return Forecast{}, dasherr.FromStatus(ServiceName, resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status))
+	}
+
+	var body struct {
+		Daily struct {
+			WeatherCode         []int     `json:"weather_code"`
+			Min                 []float64 `json:"temperature_2m_min"`
+			Max                 []float64 `json:"temperature_2m_max"`
+			PrecipitationChance []int     `json:"precipitation_probability_max"`
+		} `json:"daily"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Forecast{}, dasherr.New(dasherr.Unavailable, ServiceName, fmt.Errorf("decoding the forecast: %w", err))
+	}
+	daily := body.Daily
+	if len(daily.WeatherCode) == 0 || len(daily.Min) == 0 || len(daily.Max) == 0 {
+		return Forecast{}, dasherr.New(dasherr.Unavailable, ServiceName, fmt.Errorf("no forecast for %s", date))
+	}
+
+	forecast := Forecast{Code: daily.WeatherCode[0], Low: daily.Min[0], High: daily.Max[0]}
+	if len(daily.PrecipitationChance) > 0 {
+		forecast.PrecipitationChance = daily.PrecipitationChance[0]
+	}
+	return forecast, nil
+}
+
+// timezone returns the name Open-Meteo knows loc by. The local time zone has
+// no name of its own, so Open-Meteo works it out from the coordinates instead.
+func timezone(loc *time.Location) string {
+	if name := loc.String(); name != "Local" {
+		return name
+	}
+	return "auto"
+}
+
+// classifyError wraps err, from sending a request, in a dasherr.Error if the
+// request didn't get through.
+func classifyError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return dasherr.New(dasherr.Unavailable, ServiceName, err)
+	}
+	return err
+}
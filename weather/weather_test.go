@@ -0,0 +1,90 @@
+package weather
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gouthamve/gophercal/dasherr"
+)
+
+func TestForecast(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"daily":{"time":["2024-03-05"],"weather_code":[61],"temperature_2m_min":[3.6],"temperature_2m_max":[11.8],"precipitation_probability_max":[80]}}`)
+	}))
+	defer srv.Close()
+
+	w := New(Location{Latitude: 52.52, Longitude: 13.41})
+	w.apiURL = srv.URL
+	got, err := w.Forecast(time.Date(2024, time.March, 5, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Forecast{Code: 61, Low: 3.6, High: 11.8, PrecipitationChance: 80}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if s, want := got.String(), "Rain, 4–12°C, 80% chance of rain"; s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+	wantQuery := "daily=weather_code%2Ctemperature_2m_min%2Ctemperature_2m_max%2Cprecipitation_probability_max&end_date=2024-03-05&latitude=52.52&longitude=13.41&start_date=2024-03-05&timezone=UTC"
+	if query != wantQuery {
+		t.Errorf("got query %s, want %s", query, wantQuery)
+	}
+}
+
+func TestForecastErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   dasherr.Kind
+	}{
+		{status: http.StatusTooManyRequests, want: dasherr.RateLimited},
+		{status: http.StatusBadRequest, want: dasherr.InvalidConfig},
+		{status: http.StatusBadGateway, want: dasherr.Unavailable},
+	}
+
+	for _, tc := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+		}))
+		w := New(Location{})
+		w.apiURL = srv.URL
+		_, err := w.Forecast(time.Now())
+		srv.Close()
+
+		if got := dasherr.KindOf(err); got != tc.want {
+			t.Errorf("status %d: got %v, want %v", tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Location
+		wantErr bool
+	}{
+		{in: "52.52,13.41", want: Location{Latitude: 52.52, Longitude: 13.41}},
+		{in: "-33.87, 151.21", want: Location{Latitude: -33.87, Longitude: 151.21}},
+		{in: "0,0", want: Location{}},
+		{in: "52.52", wantErr: true},
+		{in: "91,0", wantErr: true},
+		{in: "0,east", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseLocation(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseLocation(%q): got error %v, want error %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseLocation(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}